@@ -0,0 +1,96 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// HealthCheckPolicySpec bounds the health checks of a namespace. Intervals and timeouts out of
+// bounds are clamped, checks on other protocols or methods are disabled and the ones over the quota deleted.
+type HealthCheckPolicySpec struct {
+	// MinInterval is the shortest interval between probes.
+	// +kubebuilder:validation:XValidation:rule="duration(self) >= duration('1s')",message="must be at least 1s"
+	// +optional
+	MinInterval *metav1.Duration `json:"minInterval,omitempty"`
+
+	// MaxTimeout is the longest timeout of a probe.
+	// +kubebuilder:validation:XValidation:rule="duration(self) >= duration('1s')",message="must be at least 1s"
+	// +optional
+	MaxTimeout *metav1.Duration `json:"maxTimeout,omitempty"`
+
+	// MaxChecks is the number of health checks the namespace may have.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	MaxChecks *int32 `json:"maxChecks,omitempty"`
+
+	// AllowedProtocols are the protocols checks may use, any when empty.
+	// +kubebuilder:validation:items:Enum=http;https;grpc;grpcs;tcp;tls
+	// +optional
+	AllowedProtocols []string `json:"allowedProtocols,omitempty"`
+
+	// AllowedMethods are the methods HTTP checks may use, any when empty.
+	// +kubebuilder:validation:items:Enum=GET;HEAD;POST;PUT;PATCH;DELETE;OPTIONS
+	// +optional
+	AllowedMethods []string `json:"allowedMethods,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:shortName=hcp
+
+// HealthCheckPolicy bounds the health checks of its namespace.
+type HealthCheckPolicy struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec HealthCheckPolicySpec `json:"spec,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// HealthCheckPolicyList contains a list of HealthCheckPolicy.
+type HealthCheckPolicyList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []HealthCheckPolicy `json:"items"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:scope=Cluster,shortName=chcp
+
+// ClusterHealthCheckPolicy bounds the health checks of every namespace. Where several policies
+// apply, the most restrictive bound of each wins.
+type ClusterHealthCheckPolicy struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec HealthCheckPolicySpec `json:"spec,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// ClusterHealthCheckPolicyList contains a list of ClusterHealthCheckPolicy.
+type ClusterHealthCheckPolicyList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ClusterHealthCheckPolicy `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&HealthCheckPolicy{}, &HealthCheckPolicyList{},
+		&ClusterHealthCheckPolicy{}, &ClusterHealthCheckPolicyList{})
+}
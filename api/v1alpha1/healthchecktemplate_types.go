@@ -0,0 +1,113 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// HealthCheckTemplateSpec is a partial health check spec. The settings it leaves unset keep
+// their defaults, and the wenti.dev/health-check-* annotations of an Ingress override it.
+type HealthCheckTemplateSpec struct {
+	// Protocol of the check.
+	// +kubebuilder:validation:Enum=http;https;grpc;grpcs;tcp;tls
+	// +optional
+	Protocol string `json:"protocol,omitempty"`
+
+	// Port of the check.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=65535
+	// +optional
+	Port *int32 `json:"port,omitempty"`
+
+	// Path requested by HTTP checks.
+	// +kubebuilder:validation:Pattern=`^/`
+	// +optional
+	Path string `json:"path,omitempty"`
+
+	// Method of the requests of HTTP checks.
+	// +kubebuilder:validation:Enum=GET;HEAD;POST;PUT;PATCH;DELETE;OPTIONS
+	// +optional
+	Method string `json:"method,omitempty"`
+
+	// SuccessCodes are the comma separated status codes HTTP checks accept.
+	// +optional
+	SuccessCodes string `json:"successCodes,omitempty"`
+
+	// Headers sent with the requests of HTTP checks.
+	// +optional
+	Headers map[string]string `json:"headers,omitempty"`
+
+	// GRPCService is the service gRPC checks ask the health of.
+	// +optional
+	GRPCService string `json:"grpcService,omitempty"`
+
+	// Timeout of a probe.
+	// +optional
+	Timeout *metav1.Duration `json:"timeout,omitempty"`
+
+	// Interval between probes.
+	// +optional
+	Interval *metav1.Duration `json:"interval,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:shortName=hct
+
+// HealthCheckTemplate is a health check profile shared by the Ingresses of its namespace
+// referencing it with the wenti.dev/health-check-template annotation.
+type HealthCheckTemplate struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec HealthCheckTemplateSpec `json:"spec,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// HealthCheckTemplateList contains a list of HealthCheckTemplate.
+type HealthCheckTemplateList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []HealthCheckTemplate `json:"items"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:scope=Cluster,shortName=chct
+
+// ClusterHealthCheckTemplate is a health check profile shared by the Ingresses of every
+// namespace, used when their namespace has no HealthCheckTemplate of the same name.
+type ClusterHealthCheckTemplate struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec HealthCheckTemplateSpec `json:"spec,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// ClusterHealthCheckTemplateList contains a list of ClusterHealthCheckTemplate.
+type ClusterHealthCheckTemplateList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ClusterHealthCheckTemplate `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&HealthCheckTemplate{}, &HealthCheckTemplateList{},
+		&ClusterHealthCheckTemplate{}, &ClusterHealthCheckTemplateList{})
+}
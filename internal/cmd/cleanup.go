@@ -0,0 +1,145 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/wentidev/agent/internal/utils"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Cleanup modes
+const (
+	CleanupDelete  = "delete"
+	CleanupDisable = "disable"
+)
+
+// Cleanup deletes, or disables, every check owned by this agent and cluster, typically when
+// the agent is uninstalled. Without --yes it only lists the checks it would touch.
+func Cleanup(args []string) int {
+	var verbose, yes bool
+	var mode, scaleDown string
+	var scaleDownTimeout time.Duration
+	kube := &kubeFlags{}
+	fs := newFlagSet("cleanup", &verbose)
+	kube.bind(fs)
+	fs.StringVar(&mode, "mode", CleanupDelete, "What to do with the owned checks, delete or disable.")
+	fs.BoolVar(&yes, "yes", false, "Confirm the cleanup. Without it, the checks are only listed.")
+	fs.StringVar(&scaleDown, "scale-down", "",
+		"The namespace/name of the agent Deployment to scale to zero first, so that it does not recreate the checks.")
+	fs.DurationVar(&scaleDownTimeout, "scale-down-timeout", 2*time.Minute,
+		"How long to wait for the agent Deployment to scale down.")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	if mode != CleanupDelete && mode != CleanupDisable {
+		return fail("unknown mode %q", mode)
+	}
+	setupLogger(verbose)
+	utils.DryRun = !yes
+
+	ctx := context.Background()
+	if scaleDown != "" && yes {
+		c, err := kube.client()
+		if err != nil {
+			return fail("unable to create kubernetes client: %v", err)
+		}
+		if err := scaleDownDeployment(ctx, c, scaleDown, scaleDownTimeout); err != nil {
+			return fail("unable to scale down %s: %v", scaleDown, err)
+		}
+	}
+
+	if err := utils.Checks.Refresh(ctx); err != nil {
+		return fail("unable to list health checks: %v", err)
+	}
+	failed := cleanupChecks(ctx, os.Stdout, ownedChecks(utils.Checks), mode)
+	if !yes {
+		fmt.Fprintln(os.Stdout, "Nothing was changed, run again with --yes to clean up.")
+	}
+	if failed > 0 {
+		return ExitError
+	}
+	return ExitOK
+}
+
+// ownedChecks returns the checks owned by this agent and cluster
+func ownedChecks(checks *utils.CheckCache) []utils.RemoteCheck {
+	var owned []utils.RemoteCheck
+	for _, check := range checks.All() {
+		if check.Owner() != "" {
+			owned = append(owned, check)
+		}
+	}
+	return owned
+}
+
+// cleanupChecks deletes or disables the checks, reporting each of them, and returns the
+// number of failures
+func cleanupChecks(ctx context.Context, w io.Writer, checks []utils.RemoteCheck, mode string) int {
+	failed := 0
+	for _, check := range checks {
+		var status string
+		var err error
+		if mode == CleanupDisable {
+			status, err = utils.DisableHealthCheck(ctx, check)
+		} else {
+			status, err = utils.DeleteHealthCheckByID(ctx, check)
+		}
+		if err != nil {
+			failed++
+			status = "failed: " + err.Error()
+		}
+		fmt.Fprintf(w, "  %s %s %s (%s)\n", check.ID, check.Owner(), check.Target, status)
+	}
+	fmt.Fprintf(w, "\n%d checks owned by cluster %s, %d failed.\n", len(checks), utils.ClusterName, failed)
+	return failed
+}
+
+// scaleDownDeployment scales the deployment to zero and waits for its pods to be gone
+func scaleDownDeployment(ctx context.Context, c client.Client, name string, timeout time.Duration) error {
+	namespace, name, ok := strings.Cut(name, "/")
+	if !ok {
+		return fmt.Errorf("expected namespace/name")
+	}
+	key := types.NamespacedName{Namespace: namespace, Name: name}
+	deployment := &appsv1.Deployment{}
+	if err := c.Get(ctx, key, deployment); err != nil {
+		return err
+	}
+	patch := client.MergeFrom(deployment.DeepCopy())
+	replicas := int32(0)
+	deployment.Spec.Replicas = &replicas
+	if err := c.Patch(ctx, deployment, patch); err != nil {
+		return err
+	}
+
+	return wait.PollUntilContextTimeout(ctx, 2*time.Second, timeout, true, func(ctx context.Context) (bool, error) {
+		if err := c.Get(ctx, key, deployment); err != nil {
+			return false, err
+		}
+		return deployment.Status.Replicas == 0, nil
+	})
+}
@@ -0,0 +1,50 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/wentidev/agent/internal/utils"
+)
+
+var _ = Describe("Cleanup", func() {
+	It("should list the checks owned by this cluster in dry-run", func() {
+		utils.DryRun = true
+		DeferCleanup(func() { utils.DryRun = false })
+
+		mine := remoteCheck("1", newIngress("web", "example.com", nil))
+		theirs := remoteCheck("2", newIngress("api", "api.example.com", nil))
+		theirs.Labels[utils.ClusterLabel] = "other"
+		checks := utils.NewCheckCache()
+		checks.Put(mine)
+		checks.Put(theirs)
+		checks.Put(utils.RemoteCheck{ID: "3", Target: "example.com"})
+
+		owned := ownedChecks(checks)
+		Expect(owned).To(HaveLen(1))
+		Expect(owned[0].ID).To(Equal("1"))
+
+		out := &bytes.Buffer{}
+		Expect(cleanupChecks(context.Background(), out, owned, CleanupDisable)).To(Equal(0))
+		Expect(out.String()).To(ContainSubstring("1 Ingress/default/web example.com (would disable)"))
+	})
+})
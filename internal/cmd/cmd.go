@@ -0,0 +1,140 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package cmd holds the subcommands of the agent binary, run next to the controller manager
+// for audits, CI and migrations.
+package cmd
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/go-logr/logr"
+	monitoringv1alpha1 "github.com/wentidev/agent/api/v1alpha1"
+	"github.com/wentidev/agent/internal/utils"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/clientcmd"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+)
+
+// Exit codes of the subcommands
+const (
+	ExitOK    = 0
+	ExitError = 1
+	// ExitDrift reports that the cluster and the account differ
+	ExitDrift = 2
+)
+
+// Commands maps the subcommand names to their entrypoints
+var Commands = map[string]func(args []string) int{
+	"cleanup": Cleanup,
+	"export":  Export,
+	"import":  Import,
+	"lint":    Lint,
+	"plan":    Plan,
+}
+
+// kubeFlags are the flags selecting the cluster to read from
+type kubeFlags struct {
+	kubeconfig string
+	context    string
+	namespace  string
+}
+
+func (k *kubeFlags) bind(fs *flag.FlagSet) {
+	fs.StringVar(&k.kubeconfig, "kubeconfig", "", "Path to the kubeconfig file, defaults to the usual loading rules.")
+	fs.StringVar(&k.context, "context", "", "The kubeconfig context to use.")
+	fs.StringVar(&k.namespace, "namespace", "", "Only consider this namespace, all namespaces when empty.")
+}
+
+// client returns a client for the selected cluster
+func (k *kubeFlags) client() (client.Client, error) {
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	rules.ExplicitPath = k.kubeconfig
+	config, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules,
+		&clientcmd.ConfigOverrides{CurrentContext: k.context}).ClientConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		return nil, err
+	}
+	if err := monitoringv1alpha1.AddToScheme(scheme); err != nil {
+		return nil, err
+	}
+	return client.New(config, client.Options{Scheme: scheme})
+}
+
+// newFlagSet returns the flag set of a subcommand with the flags shared by all of them
+func newFlagSet(name string, verbose *bool) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	utils.BindClientFlags(fs)
+	fs.BoolVar(verbose, "v", false, "Log the details of every operation to stderr.")
+	return fs
+}
+
+// parseFlags parses the arguments of a subcommand, ok is false when it must exit with code
+func parseFlags(fs *flag.FlagSet, args []string) (code int, ok bool) {
+	err := fs.Parse(args)
+	if errors.Is(err, flag.ErrHelp) {
+		return ExitOK, false
+	}
+	if err != nil {
+		return ExitError, false
+	}
+	if err := utils.ValidateRateLimit(); err != nil {
+		return fail("%v", err), false
+	}
+	return ExitOK, true
+}
+
+// loadConfig compiles the rules and name templates of the agent configuration file, if any
+func loadConfig() error {
+	if utils.ConfigFile == "" {
+		return nil
+	}
+	config, err := utils.LoadConfig(utils.ConfigFile)
+	if err != nil {
+		return err
+	}
+	if utils.Rules, err = utils.CompileRules(config.Rules); err != nil {
+		return err
+	}
+	utils.Names, err = utils.CompileNames(config.Names)
+	return err
+}
+
+// setupLogger discards the logs of the shared packages unless verbose is set
+func setupLogger(verbose bool) {
+	if verbose {
+		ctrl.SetLogger(zap.New(zap.WriteTo(os.Stderr), zap.UseDevMode(true)))
+		return
+	}
+	ctrl.SetLogger(logr.Discard())
+}
+
+// fail prints an error and returns the error exit code
+func fail(format string, args ...interface{}) int {
+	fmt.Fprintf(os.Stderr, "error: "+format+"\n", args...)
+	return ExitError
+}
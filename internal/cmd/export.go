@@ -0,0 +1,227 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/wentidev/agent/internal/utils"
+	networkingv1 "k8s.io/api/networking/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+)
+
+// IngressPatch carries the annotations reproducing a check on the Ingress it maps to
+type IngressPatch struct {
+	Namespace   string
+	Name        string
+	CheckID     string
+	Annotations map[string]string
+}
+
+// StandaloneCheck is a check which does not map to any Ingress
+type StandaloneCheck struct {
+	Check  utils.RemoteCheck
+	Reason string
+}
+
+// ExportResult splits the checks of the account by whether they map to an Ingress
+type ExportResult struct {
+	Patches    []IngressPatch
+	Standalone []StandaloneCheck
+}
+
+// Export prints every check of the account as YAML: merge patches adding the
+// wenti.dev/health-check-* annotations to the Ingresses the checks map to, followed by the
+// checks which map to no Ingress. The patches can be applied with
+// kubectl apply --server-side --field-manager=wenti-export.
+func Export(args []string) int {
+	var verbose bool
+	var standaloneFile string
+	kube := &kubeFlags{}
+	fs := newFlagSet("export", &verbose)
+	kube.bind(fs)
+	fs.StringVar(&standaloneFile, "standalone-file", "",
+		"Write the checks which map to no Ingress to this file instead of stdout.")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	setupLogger(verbose)
+
+	ctx := context.Background()
+	c, err := kube.client()
+	if err != nil {
+		return fail("unable to create kubernetes client: %v", err)
+	}
+	checks := utils.NewCheckCache()
+	if err := checks.Refresh(ctx); err != nil {
+		return fail("unable to list health checks: %v", err)
+	}
+
+	result, err := computeExport(ctx, c, checks, kube.namespace)
+	if err != nil {
+		return fail("%v", err)
+	}
+
+	if err := printPatches(os.Stdout, result.Patches); err != nil {
+		return fail("unable to print patches: %v", err)
+	}
+	var standalone io.Writer = os.Stdout
+	if standaloneFile != "" {
+		file, err := os.Create(standaloneFile)
+		if err != nil {
+			return fail("%v", err)
+		}
+		defer file.Close()
+		standalone = file
+	}
+	if err := printStandalone(standalone, result.Standalone); err != nil {
+		return fail("unable to print checks: %v", err)
+	}
+	return ExitOK
+}
+
+// computeExport maps each check to an Ingress: the one owning it, the one recording its ID,
+// or for unmanaged checks the single Ingress serving its target. An Ingress holds a single
+// check, any other check mapping to it is exported as standalone.
+func computeExport(ctx context.Context, c client.Client, checks *utils.CheckCache, namespace string) (ExportResult, error) {
+	ingresses := &networkingv1.IngressList{}
+	if err := c.List(ctx, ingresses, client.InNamespace(namespace)); err != nil {
+		return ExportResult{}, fmt.Errorf("unable to list ingresses: %w", err)
+	}
+
+	byOwner := map[string]*networkingv1.Ingress{}
+	byID := map[string]*networkingv1.Ingress{}
+	byHost := map[string][]*networkingv1.Ingress{}
+	for i := range ingresses.Items {
+		ingress := &ingresses.Items[i]
+		byOwner[utils.OwnerKey("Ingress", ingress.Namespace, ingress.Name)] = ingress
+		if id := utils.GetStringAnnotation(ingress, utils.HealthCheckID); id != "" {
+			byID[id] = ingress
+		}
+		if len(ingress.Spec.Rules) > 0 && ingress.Spec.Rules[0].Host != "" {
+			host := strings.ToLower(ingress.Spec.Rules[0].Host)
+			byHost[host] = append(byHost[host], ingress)
+		}
+	}
+
+	result := ExportResult{}
+	taken := map[*networkingv1.Ingress]string{}
+	for _, check := range checks.All() {
+		ingress, reason := byID[check.ID], ""
+		switch {
+		case ingress != nil:
+		case check.Owner() != "":
+			ingress = byOwner[check.Owner()]
+			if ingress == nil {
+				reason = fmt.Sprintf("owned by %s, which does not exist", check.Owner())
+			}
+		case !check.Unmanaged():
+			reason = "managed by another agent or cluster"
+		default:
+			candidates := byHost[strings.ToLower(check.Target)]
+			if len(candidates) == 1 {
+				ingress = candidates[0]
+			} else if len(candidates) > 1 {
+				reason = fmt.Sprintf("%d ingresses serve %s", len(candidates), check.Target)
+			} else {
+				reason = fmt.Sprintf("no ingress serves %s", check.Target)
+			}
+		}
+		if ingress != nil && taken[ingress] != "" {
+			reason = fmt.Sprintf("ingress %s/%s already holds check %s", ingress.Namespace, ingress.Name, taken[ingress])
+			ingress = nil
+		}
+		if ingress == nil {
+			if namespace == "" || strings.HasPrefix(check.Owner(), utils.OwnerKey("Ingress", namespace, "")) {
+				result.Standalone = append(result.Standalone, StandaloneCheck{Check: check, Reason: reason})
+			}
+			continue
+		}
+
+		taken[ingress] = check.ID
+		result.Patches = append(result.Patches, IngressPatch{
+			Namespace:   ingress.Namespace,
+			Name:        ingress.Name,
+			CheckID:     check.ID,
+			Annotations: checkAnnotations(check),
+		})
+	}
+	return result, nil
+}
+
+// checkAnnotations returns the annotations reproducing the check
+func checkAnnotations(check utils.RemoteCheck) map[string]string {
+	annotations := map[string]string{utils.HealthCheckID: check.ID}
+	set := func(annotation, value string) {
+		if value != "" && value != "0" {
+			annotations[annotation] = value
+		}
+	}
+	set(utils.HealthCheckProtocol, check.Protocol)
+	set(utils.HealthCheckPort, strconv.Itoa(check.Port))
+	set(utils.HealthCheckTimeout, strconv.Itoa(check.Timeout))
+	set(utils.HealthCheckInterval, strconv.Itoa(check.Interval))
+	// The request settings only apply to HTTP checks, the agent rejects them on the others
+	if check.Protocol == "" || utils.IsHTTPProtocol(strings.ToLower(check.Protocol)) {
+		set(utils.HealthCheckMethod, check.Method)
+		set(utils.HealthCheckPath, check.Path)
+		set(utils.HealthCheckHTTPCode, check.HTTPCode)
+	}
+	return annotations
+}
+
+// printPatches writes the patches as a multi-document YAML stream of partial Ingresses
+func printPatches(w io.Writer, patches []IngressPatch) error {
+	for _, patch := range patches {
+		data, err := yaml.Marshal(map[string]interface{}{
+			"apiVersion": networkingv1.SchemeGroupVersion.String(),
+			"kind":       "Ingress",
+			"metadata": map[string]interface{}{
+				"name":        patch.Name,
+				"namespace":   patch.Namespace,
+				"annotations": patch.Annotations,
+			},
+		})
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "---\n# check %s\n%s", patch.CheckID, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// printStandalone writes the checks as YAML documents. They are not Kubernetes objects.
+func printStandalone(w io.Writer, checks []StandaloneCheck) error {
+	for _, standalone := range checks {
+		data, err := yaml.Marshal(standalone.Check)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "---\n# standalone check: %s\n%s", standalone.Reason, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
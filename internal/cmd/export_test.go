@@ -0,0 +1,72 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/wentidev/agent/internal/utils"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("Export", func() {
+	It("should map checks to ingresses", func() {
+		owned := newIngress("owned", "owned.example.com", nil)
+		pinned := newIngress("pinned", "pinned.example.com", map[string]string{utils.HealthCheckID: "2"})
+		web := newIngress("web", "web.example.com", nil)
+		webToo := newIngress("web-too", "web.example.com", nil)
+		api := newIngress("api", "api.example.com", nil)
+
+		checks := utils.NewCheckCache()
+		checks.Put(remoteCheck("1", owned))
+		checks.Put(utils.RemoteCheck{ID: "2", Target: "elsewhere.example.com", Port: 443, Path: "/healthz"})
+		checks.Put(utils.RemoteCheck{ID: "3", Target: "web.example.com"})
+		checks.Put(utils.RemoteCheck{ID: "4", Target: "API.example.com", Method: "HEAD", Interval: 30})
+		checks.Put(utils.RemoteCheck{ID: "5", Target: "api.example.com"})
+
+		c := fake.NewClientBuilder().WithObjects(owned, pinned, web, webToo, api).Build()
+		result, err := computeExport(context.Background(), c, checks, "")
+		Expect(err).NotTo(HaveOccurred())
+
+		patches := map[string]IngressPatch{}
+		for _, patch := range result.Patches {
+			patches[patch.Name] = patch
+		}
+		Expect(patches).To(HaveLen(3))
+		Expect(patches["owned"].CheckID).To(Equal("1"))
+		Expect(patches["pinned"].Annotations).To(Equal(map[string]string{
+			utils.HealthCheckID:   "2",
+			utils.HealthCheckPath: "/healthz",
+			utils.HealthCheckPort: "443",
+		}))
+		Expect(patches["api"].Annotations).To(HaveKeyWithValue(utils.HealthCheckMethod, "HEAD"))
+		Expect(patches["api"].Annotations).To(HaveKeyWithValue(utils.HealthCheckInterval, "30"))
+
+		Expect(result.Standalone).To(HaveLen(2))
+		Expect(result.Standalone[0].Check.ID).To(Equal("3"))
+		Expect(result.Standalone[0].Reason).To(Equal("2 ingresses serve web.example.com"))
+		Expect(result.Standalone[1].Reason).To(ContainSubstring("already holds check 4"))
+
+		out := &bytes.Buffer{}
+		Expect(printPatches(out, result.Patches)).To(Succeed())
+		Expect(out.String()).To(ContainSubstring("wenti.dev/health-check-id: \"2\""))
+	})
+})
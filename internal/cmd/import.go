@@ -0,0 +1,258 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/wentidev/agent/internal/controller"
+	"github.com/wentidev/agent/internal/utils"
+	networkingv1 "k8s.io/api/networking/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// ImportMatch is the outcome of matching one Ingress against the unmanaged checks
+type ImportMatch struct {
+	Owner    string   `json:"owner"`
+	Target   string   `json:"target"`
+	CheckIDs []string `json:"checkIds,omitempty"`
+	// Reason explains an ambiguous match or a failed adoption
+	Reason string `json:"reason,omitempty"`
+
+	ingress  *networkingv1.Ingress
+	resource utils.IngressInfo
+}
+
+// ImportResult lists the checks to adopt and the matches left to a human
+type ImportResult struct {
+	Adopted   []ImportMatch `json:"adopted"`
+	Ambiguous []ImportMatch `json:"ambiguous"`
+	Failed    []ImportMatch `json:"failed,omitempty"`
+	// Unmatched are the Ingresses without a check, the controller creates one for them
+	Unmatched []string `json:"unmatched"`
+}
+
+// Import adopts the unmanaged checks matching the Ingresses of the current cluster under the
+// --match rule: each check is labelled as owned by its Ingress and its ID is recorded in the
+// wenti.dev/health-check-id annotation. Ambiguous matches are reported and left untouched,
+// and make it exit with ExitDrift.
+func Import(args []string) int {
+	var verbose bool
+	var output string
+	kube := &kubeFlags{}
+	fs := newFlagSet("import", &verbose)
+	kube.bind(fs)
+	fs.Var(&utils.AdoptMatch, "match",
+		"The comma separated settings an unmanaged check must share with an Ingress to be adopted, "+
+			"among target, path, method, protocol, port and name.")
+	fs.BoolVar(&utils.DryRun, "dry-run", false, "If set, the matches are only reported, nothing is written.")
+	fs.StringVar(&output, "output", "text", "The output format, text or json.")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	if output != "text" && output != "json" {
+		return fail("unknown output format %q", output)
+	}
+	setupLogger(verbose)
+
+	ctx := context.Background()
+	c, err := kube.client()
+	if err != nil {
+		return fail("unable to create kubernetes client: %v", err)
+	}
+	if err := utils.Checks.Refresh(ctx); err != nil {
+		return fail("unable to list health checks: %v", err)
+	}
+
+	result, err := computeImport(ctx, c, utils.Checks, kube.namespace)
+	if err != nil {
+		return fail("%v", err)
+	}
+	if !utils.DryRun {
+		applyImport(ctx, c, &result)
+	}
+
+	if output == "json" {
+		err = json.NewEncoder(os.Stdout).Encode(result)
+	} else {
+		err = printImport(os.Stdout, result)
+	}
+	if err != nil {
+		return fail("unable to print result: %v", err)
+	}
+
+	switch {
+	case len(result.Failed) > 0:
+		return ExitError
+	case len(result.Ambiguous) > 0:
+		return ExitDrift
+	}
+	return ExitOK
+}
+
+// computeImport matches the Ingresses without a check of their own to the unmanaged checks.
+// A match is ambiguous when an Ingress matches several checks or a check matches several
+// Ingresses. The wenti.dev/health-check-id annotation, when set, picks the check to adopt.
+func computeImport(ctx context.Context, c client.Client, checks *utils.CheckCache, namespace string) (ImportResult, error) {
+	ingresses := &networkingv1.IngressList{}
+	if err := c.List(ctx, ingresses, client.InNamespace(namespace)); err != nil {
+		return ImportResult{}, fmt.Errorf("unable to list ingresses: %w", err)
+	}
+
+	reconciler := &controller.IngressReconciler{Client: c}
+	result := ImportResult{Adopted: []ImportMatch{}, Ambiguous: []ImportMatch{}, Unmatched: []string{}}
+	var matches []ImportMatch
+	pinned := map[string]bool{}
+	for i := range ingresses.Items {
+		ingress := &ingresses.Items[i]
+		ingressInfo, _, err := reconciler.DesiredCheck(ctx, ingress)
+		if errors.Is(err, utils.ErrNoHost) {
+			continue
+		}
+		if err != nil {
+			return ImportResult{}, fmt.Errorf("%s: %w", utils.OwnerKey("Ingress", ingress.Namespace, ingress.Name), err)
+		}
+		if len(checks.ByOwner(ingressInfo.Owner)) > 0 {
+			continue
+		}
+
+		match := ImportMatch{Owner: ingressInfo.Owner, Target: ingressInfo.Target, ingress: ingress, resource: ingressInfo}
+		if check, ok := checks.Get(ingressInfo.ID); ok && check.Unmanaged() {
+			match.CheckIDs = []string{check.ID}
+			pinned[check.ID] = true
+		} else {
+			for _, check := range checks.Candidates(ingressInfo, utils.AdoptMatch) {
+				match.CheckIDs = append(match.CheckIDs, check.ID)
+			}
+		}
+		matches = append(matches, match)
+	}
+
+	// Checks pinned by an annotation are out of reach of the other Ingresses
+	claims := map[string][]string{}
+	for i := range matches {
+		if matches[i].resource.ID == "" || !pinned[matches[i].resource.ID] {
+			matches[i].CheckIDs = unpinned(matches[i].CheckIDs, pinned)
+		}
+		for _, id := range matches[i].CheckIDs {
+			claims[id] = append(claims[id], matches[i].Owner)
+		}
+	}
+
+	for _, match := range matches {
+		switch {
+		case len(match.CheckIDs) == 0:
+			result.Unmatched = append(result.Unmatched, match.Owner)
+		case len(match.CheckIDs) > 1:
+			match.Reason = fmt.Sprintf("%d checks match", len(match.CheckIDs))
+			result.Ambiguous = append(result.Ambiguous, match)
+		case len(claims[match.CheckIDs[0]]) > 1:
+			match.Reason = fmt.Sprintf("the check also matches %s", strings.Join(without(claims[match.CheckIDs[0]], match.Owner), ", "))
+			result.Ambiguous = append(result.Ambiguous, match)
+		default:
+			result.Adopted = append(result.Adopted, match)
+		}
+	}
+	sort.Strings(result.Unmatched)
+	return result, nil
+}
+
+// applyImport adopts the matched checks and records their ID on the Ingresses, moving the
+// matches which fail to Failed
+func applyImport(ctx context.Context, c client.Client, result *ImportResult) {
+	adopted := []ImportMatch{}
+	for _, match := range result.Adopted {
+		err := adopt(ctx, c, match)
+		if err != nil {
+			match.Reason = err.Error()
+			result.Failed = append(result.Failed, match)
+			continue
+		}
+		adopted = append(adopted, match)
+	}
+	result.Adopted = adopted
+}
+
+func adopt(ctx context.Context, c client.Client, match ImportMatch) error {
+	id := match.CheckIDs[0]
+	if _, err := utils.AdoptHealthCheck(ctx, id, match.resource); err != nil {
+		return err
+	}
+
+	patch := client.MergeFrom(match.ingress.DeepCopy())
+	if match.ingress.Annotations == nil {
+		match.ingress.Annotations = map[string]string{}
+	}
+	match.ingress.Annotations[utils.HealthCheckID] = id
+	if err := c.Patch(ctx, match.ingress, patch); err != nil {
+		return fmt.Errorf("check %s adopted but not recorded on the ingress: %w", id, err)
+	}
+	return nil
+}
+
+func unpinned(ids []string, pinned map[string]bool) []string {
+	var result []string
+	for _, id := range ids {
+		if !pinned[id] {
+			result = append(result, id)
+		}
+	}
+	return result
+}
+
+func without(values []string, value string) []string {
+	result := []string{}
+	for _, v := range values {
+		if v != value {
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
+// printImport writes the result in a human readable form
+func printImport(w io.Writer, result ImportResult) error {
+	verb := "adopted"
+	if utils.DryRun {
+		verb = "would adopt"
+	}
+	var lines []string
+	for _, match := range result.Adopted {
+		lines = append(lines, fmt.Sprintf("  %s %s for %s (%s)", verb, match.CheckIDs[0], match.Owner, match.Target))
+	}
+	for _, match := range result.Failed {
+		lines = append(lines, fmt.Sprintf("  failed %s for %s (%s): %s", match.CheckIDs[0], match.Owner, match.Target, match.Reason))
+	}
+	for _, match := range result.Ambiguous {
+		lines = append(lines, fmt.Sprintf("  ambiguous %s for %s (%s): %s, set %s to pick one",
+			strings.Join(match.CheckIDs, ", "), match.Owner, match.Target, match.Reason, utils.HealthCheckID))
+	}
+	for _, owner := range result.Unmatched {
+		lines = append(lines, fmt.Sprintf("  no match for %s", owner))
+	}
+	lines = append(lines, fmt.Sprintf("\n%d %s, %d failed, %d ambiguous, %d without match.",
+		len(result.Adopted), verb, len(result.Failed), len(result.Ambiguous), len(result.Unmatched)))
+	_, err := fmt.Fprintln(w, strings.Join(lines, "\n"))
+	return err
+}
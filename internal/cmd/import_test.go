@@ -0,0 +1,81 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/wentidev/agent/internal/utils"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("Import", func() {
+	handMade := func(id, target string) utils.RemoteCheck {
+		return utils.RemoteCheck{ID: id, Target: target, Method: "GET", Path: "/", Port: 8080}
+	}
+
+	It("should match ingresses to unmanaged checks", func() {
+		owned := newIngress("owned", "owned.example.com", nil)
+		single := newIngress("single", "single.example.com", nil)
+		twice := newIngress("twice", "twice.example.com", nil)
+		pinned := newIngress("pinned", "twice.example.com", map[string]string{utils.HealthCheckID: "4"})
+		shared := newIngress("shared", "shared.example.com", nil)
+		sharedToo := newIngress("shared-too", "shared.example.com", nil)
+		missing := newIngress("missing", "missing.example.com", nil)
+
+		checks := utils.NewCheckCache()
+		checks.Put(remoteCheck("1", owned))
+		checks.Put(handMade("2", "single.example.com"))
+		checks.Put(handMade("3", "twice.example.com"))
+		checks.Put(handMade("4", "twice.example.com"))
+		checks.Put(handMade("5", "shared.example.com"))
+		checks.Put(handMade("6", "owned.example.com"))
+
+		c := fake.NewClientBuilder().WithObjects(owned, single, twice, pinned, shared, sharedToo, missing).Build()
+		result, err := computeImport(context.Background(), c, checks, "")
+		Expect(err).NotTo(HaveOccurred())
+
+		owners := func(matches []ImportMatch) []string {
+			var keys []string
+			for _, match := range matches {
+				keys = append(keys, match.Owner)
+			}
+			return keys
+		}
+		Expect(owners(result.Adopted)).To(ConsistOf(
+			utils.OwnerKey("Ingress", "default", "single"),
+			utils.OwnerKey("Ingress", "default", "pinned"),
+			utils.OwnerKey("Ingress", "default", "twice"),
+		))
+		Expect(owners(result.Ambiguous)).To(ConsistOf(
+			utils.OwnerKey("Ingress", "default", "shared"),
+			utils.OwnerKey("Ingress", "default", "shared-too"),
+		))
+		for _, match := range result.Adopted {
+			switch match.Owner {
+			case utils.OwnerKey("Ingress", "default", "pinned"):
+				Expect(match.CheckIDs).To(Equal([]string{"4"}))
+			case utils.OwnerKey("Ingress", "default", "twice"):
+				Expect(match.CheckIDs).To(Equal([]string{"3"}))
+			}
+		}
+		Expect(result.Unmatched).To(Equal([]string{utils.OwnerKey("Ingress", "default", "missing")}))
+	})
+})
@@ -0,0 +1,254 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/wentidev/agent/internal/utils"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+)
+
+// LintResult is the outcome of linting one Ingress
+type LintResult struct {
+	Source    string             `json:"source"`
+	Namespace string             `json:"namespace"`
+	Name      string             `json:"name"`
+	Check     *utils.IngressInfo `json:"check,omitempty"`
+	Errors    []string           `json:"errors,omitempty"`
+	Warnings  []string           `json:"warnings,omitempty"`
+}
+
+// Lint checks the wenti.dev/ annotations of the Ingresses found in rendered manifests,
+// read from the files given as arguments or from stdin, without any cluster or API access
+func Lint(args []string) int {
+	var output, namespace string
+	fs := flag.NewFlagSet("lint", flag.ContinueOnError)
+	fs.StringVar(&output, "output", "text", "The output format, text or json.")
+	fs.StringVar(&namespace, "namespace", "default", "The namespace of the objects which do not set one.")
+	fs.StringVar(&utils.ConfigFile, "config", "",
+		"The agent configuration file whose rules and name templates apply to the Ingresses. "+
+			"Rules see namespaces without labels nor annotations.")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: agent lint [flags] [file ...]\n\nReads stdin when no file or - is given.")
+		fs.PrintDefaults()
+	}
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	if output != "text" && output != "json" {
+		return fail("unknown output format %q", output)
+	}
+	if err := loadConfig(); err != nil {
+		return fail("%v", err)
+	}
+
+	sources := fs.Args()
+	if len(sources) == 0 {
+		sources = []string{"-"}
+	}
+	results := []LintResult{}
+	for _, source := range sources {
+		fileResults, err := lintSource(source, namespace, time.Now())
+		if err != nil {
+			return fail("%s: %v", source, err)
+		}
+		results = append(results, fileResults...)
+	}
+
+	var err error
+	if output == "json" {
+		err = json.NewEncoder(os.Stdout).Encode(results)
+	} else {
+		err = printLint(os.Stdout, results)
+	}
+	if err != nil {
+		return fail("unable to print results: %v", err)
+	}
+
+	for _, result := range results {
+		if len(result.Errors) > 0 {
+			return ExitError
+		}
+	}
+	return ExitOK
+}
+
+// lintSource lints the manifests of a file, or of stdin for -
+func lintSource(source, namespace string, now time.Time) ([]LintResult, error) {
+	if source == "-" {
+		return lintManifests(os.Stdin, source, namespace, now)
+	}
+	file, err := os.Open(source)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return lintManifests(file, source, namespace, now)
+}
+
+// lintManifests lints the Ingresses of a multi-document YAML or JSON stream, including the
+// items of List objects. Other kinds are ignored.
+func lintManifests(reader io.Reader, source, namespace string, now time.Time) ([]LintResult, error) {
+	results := []LintResult{}
+	decoder := utilyaml.NewYAMLOrJSONDecoder(reader, 4096)
+	for {
+		object := &unstructured.Unstructured{}
+		if err := decoder.Decode(&object.Object); err != nil {
+			if errors.Is(err, io.EOF) {
+				return results, nil
+			}
+			return nil, err
+		}
+		if len(object.Object) == 0 {
+			continue
+		}
+
+		objects := []unstructured.Unstructured{*object}
+		if object.IsList() {
+			list, err := object.ToList()
+			if err != nil {
+				return nil, err
+			}
+			objects = list.Items
+		}
+		for i := range objects {
+			gvk := objects[i].GroupVersionKind()
+			if gvk.Kind != "Ingress" || gvk.GroupVersion() != networkingv1.SchemeGroupVersion {
+				continue
+			}
+			ingress := &networkingv1.Ingress{}
+			if err := runtime.DefaultUnstructuredConverter.FromUnstructured(objects[i].Object, ingress); err != nil {
+				return nil, fmt.Errorf("ingress %s: %w", objects[i].GetName(), err)
+			}
+			if ingress.Namespace == "" {
+				ingress.Namespace = namespace
+			}
+			if result, ok := lintIngress(ingress, now); ok {
+				result.Source = source
+				results = append(results, result)
+			}
+		}
+	}
+}
+
+// lintIngress runs the ingress through the parsing of the reconciler and the validation of
+// the settings. It returns false for Ingresses the agent ignores and which carry no annotation.
+func lintIngress(ingress *networkingv1.Ingress, now time.Time) (LintResult, bool) {
+	result := LintResult{Namespace: ingress.Namespace, Name: ingress.Name}
+
+	known := map[string]bool{}
+	for _, annotation := range utils.KnownAnnotations() {
+		known[annotation] = true
+	}
+	annotated := false
+	keys := make([]string, 0, len(ingress.Annotations))
+	for key := range ingress.Annotations {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if !strings.HasPrefix(key, "wenti.dev/") {
+			continue
+		}
+		annotated = true
+		if !known[key] {
+			result.Errors = append(result.Errors, fmt.Sprintf("unknown annotation %s", key))
+		}
+	}
+	if _, err := utils.GetMaintenance(ingress.Annotations, now); err != nil {
+		result.Errors = append(result.Errors, err.Error())
+	}
+
+	ingressInfo, err := utils.IngressInfoWithSettings(ingress, utils.IngressSettings{Rules: utils.Rules})
+	if errors.Is(err, utils.ErrNotMonitored) {
+		if !annotated {
+			return result, false
+		}
+		result.Warnings = append(result.Warnings, "a rule opts this ingress out, the agent ignores it")
+		return result, true
+	}
+	if errors.Is(err, utils.ErrNoHost) {
+		if !annotated {
+			return result, false
+		}
+		result.Warnings = append(result.Warnings, "the first rule has no host, the agent ignores this ingress")
+		return result, true
+	}
+	if err != nil {
+		result.Errors = append(result.Errors, err.Error())
+		return result, true
+	}
+	result.Check = &ingressInfo
+
+	// The validation DesiredSpec runs before a check is written
+	for _, err := range utils.ValidateIngressInfo(ingressInfo) {
+		result.Errors = append(result.Errors, err.Error())
+	}
+	interval, intervalErr := utils.ConvertDurationToSeconds(ingressInfo.Interval)
+	timeout, timeoutErr := utils.ConvertDurationToSeconds(ingressInfo.Timeout)
+	if intervalErr == nil && timeoutErr == nil && timeout > interval {
+		result.Warnings = append(result.Warnings, fmt.Sprintf("timeout of %ds exceeds the interval of %ds", timeout, interval))
+	}
+	return result, true
+}
+
+// printLint writes the results in a human readable form
+func printLint(w io.Writer, results []LintResult) error {
+	failed := 0
+	for _, result := range results {
+		if len(result.Errors) > 0 {
+			failed++
+		}
+		lines := []string{fmt.Sprintf("%s: Ingress %s/%s", result.Source, result.Namespace, result.Name)}
+		if check := result.Check; check != nil {
+			lines = append(lines, fmt.Sprintf("  check: %s %s://%s:%s%s every %s, timeout %s, expects %s, enabled %t",
+				check.Method, strings.ToLower(check.Protocol), check.Target, check.Port, check.Path,
+				seconds(check.Interval), seconds(check.Timeout), check.HTTPCode, check.Enabled))
+		}
+		for _, message := range result.Errors {
+			lines = append(lines, "  error: "+message)
+		}
+		for _, message := range result.Warnings {
+			lines = append(lines, "  warning: "+message)
+		}
+		if _, err := fmt.Fprintln(w, strings.Join(lines, "\n")); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintf(w, "\n%d ingresses checked, %d with errors.\n", len(results), failed)
+	return err
+}
+
+// seconds formats a duration setting, as given when it is invalid
+func seconds(value string) string {
+	if result, err := utils.ConvertDurationToSeconds(value); err == nil {
+		return fmt.Sprintf("%ds", result)
+	}
+	return value
+}
@@ -0,0 +1,173 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/wentidev/agent/internal/utils"
+)
+
+const manifests = `
+apiVersion: v1
+kind: Service
+metadata:
+  name: web
+---
+apiVersion: networking.k8s.io/v1
+kind: Ingress
+metadata:
+  name: web
+  annotations:
+    wenti.dev/health-check-port: "443"
+    wenti.dev/health-check-protocol: HTTPS
+    wenti.dev/health-check-interval: "10"
+    wenti.dev/health-check-timeout: "5"
+spec:
+  rules:
+    - host: example.com
+---
+apiVersion: v1
+kind: List
+items:
+  - apiVersion: networking.k8s.io/v1
+    kind: Ingress
+    metadata:
+      name: broken
+      namespace: shop
+      annotations:
+        wenti.dev/health-check-intreval: "10"
+        wenti.dev/health-check-timeout: "90s"
+        wenti.dev/maintenance-window: "0 2 * * 6"
+    spec:
+      rules:
+        - host: shop.example.com
+  - apiVersion: networking.k8s.io/v1
+    kind: Ingress
+    metadata:
+      name: default-backend
+    spec:
+      defaultBackend:
+        service:
+          name: web
+          port:
+            number: 80
+`
+
+var _ = Describe("Lint", func() {
+	It("should lint the ingresses of rendered manifests", func() {
+		results, err := lintManifests(strings.NewReader(manifests), "-", "default", time.Now())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(results).To(HaveLen(2))
+
+		Expect(results[0].Namespace).To(Equal("default"))
+		Expect(results[0].Errors).To(BeEmpty())
+		Expect(results[0].Warnings).To(BeEmpty())
+		Expect(results[0].Check.Port).To(Equal("443"))
+		Expect(results[0].Check.Interval).To(Equal("10"))
+
+		Expect(results[1].Namespace).To(Equal("shop"))
+		Expect(results[1].Errors).To(ConsistOf(
+			ContainSubstring("unknown annotation wenti.dev/health-check-intreval"),
+			ContainSubstring("wenti.dev/maintenance-window"),
+		))
+		Expect(results[1].Warnings).To(ConsistOf("timeout of 90s exceeds the interval of 60s"))
+	})
+
+	It("should reject invalid settings", func() {
+		results, err := lintManifests(strings.NewReader(`
+apiVersion: networking.k8s.io/v1
+kind: Ingress
+metadata:
+  name: web
+  annotations:
+    wenti.dev/health-check-port: "http"
+    wenti.dev/health-check-method: FETCH
+spec:
+  rules:
+    - host: example.com
+`), "-", "default", time.Now())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(results).To(HaveLen(1))
+		Expect(results[0].Errors).To(ConsistOf(
+			ContainSubstring("invalid port"),
+			ContainSubstring("unsupported method"),
+		))
+	})
+
+	It("should warn about annotated ingresses without host", func() {
+		results, err := lintManifests(strings.NewReader(`
+apiVersion: networking.k8s.io/v1
+kind: Ingress
+metadata:
+  name: web
+  annotations:
+    wenti.dev/health-check-path: /healthz
+spec: {}
+`), "-", "default", time.Now())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(results).To(HaveLen(1))
+		Expect(results[0].Warnings).To(HaveLen(1))
+		Expect(results[0].Errors).To(BeEmpty())
+	})
+
+	It("should apply the rules of the configuration file", func() {
+		path := filepath.Join(GinkgoT().TempDir(), "config.yaml")
+		Expect(os.WriteFile(path, []byte(`
+rules:
+- name: internal
+  monitor: "!has(ingress.metadata.labels.internal)"
+- name: health
+  set:
+    path: "'/healthz'"
+`), 0o600)).To(Succeed())
+		configFile, rules, names := utils.ConfigFile, utils.Rules, utils.Names
+		DeferCleanup(func() { utils.ConfigFile, utils.Rules, utils.Names = configFile, rules, names })
+		utils.ConfigFile = path
+		Expect(loadConfig()).To(Succeed())
+
+		results, err := lintManifests(strings.NewReader(`
+apiVersion: networking.k8s.io/v1
+kind: Ingress
+metadata:
+  name: web
+spec:
+  rules:
+    - host: example.com
+---
+apiVersion: networking.k8s.io/v1
+kind: Ingress
+metadata:
+  name: admin
+  labels:
+    internal: "true"
+spec:
+  rules:
+    - host: admin.example.com
+`), "-", "default", time.Now())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(results).To(HaveLen(1))
+		Expect(results[0].Name).To(Equal("web"))
+		Expect(results[0].Check.Path).To(Equal("/healthz"))
+	})
+})
@@ -0,0 +1,296 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/wentidev/agent/internal/controller"
+	"github.com/wentidev/agent/internal/utils"
+	clientsdk "github.com/wentidev/sdk-go"
+	networkingv1 "k8s.io/api/networking/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Actions of a plan
+const (
+	ActionCreate = "create"
+	ActionUpdate = "update"
+	ActionDelete = "delete"
+	// ActionConflict marks an Ingress matching several unmanaged checks, which the controller
+	// leaves alone until a human resolves it
+	ActionConflict = "conflict"
+	// ActionInvalid marks an Ingress whose settings make an invalid check, which the controller
+	// reports as an Event and leaves alone
+	ActionInvalid = "invalid"
+)
+
+// FieldChange is a setting of a check changed by an update
+type FieldChange struct {
+	Field string      `json:"field"`
+	Old   interface{} `json:"old"`
+	New   interface{} `json:"new"`
+}
+
+// Change is a write the controller would make to the account
+type Change struct {
+	Action string        `json:"action"`
+	Owner  string        `json:"owner"`
+	ID     string        `json:"id,omitempty"`
+	Name   string        `json:"name"`
+	Target string        `json:"target"`
+	Fields []FieldChange `json:"fields,omitempty"`
+	// Reason explains a conflict or an invalid check
+	Reason string `json:"reason,omitempty"`
+}
+
+// PlanResult lists the changes needed to bring the account in line with the cluster
+type PlanResult struct {
+	Changes []Change `json:"changes"`
+	Create  int      `json:"create"`
+	Update  int      `json:"update"`
+	Delete  int      `json:"delete"`
+	// Conflict counts the Ingresses with ambiguous matches
+	Conflict int `json:"conflict"`
+	// Invalid counts the Ingresses with invalid settings
+	Invalid int `json:"invalid"`
+}
+
+// Plan prints the health checks the controller would create, update and delete for the
+// Ingresses of the current cluster, and exits with ExitDrift when there is any
+func Plan(args []string) int {
+	var verbose bool
+	var output string
+	kube := &kubeFlags{}
+	fs := newFlagSet("plan", &verbose)
+	kube.bind(fs)
+	utils.BindAdoptFlags(fs)
+	fs.StringVar(&output, "output", "text", "The output format, text or json.")
+	fs.StringVar(&utils.ConfigFile, "config", "", "The agent configuration file whose rules and name templates apply to the Ingresses.")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	if err := loadConfig(); err != nil {
+		return fail("%v", err)
+	}
+	if output != "text" && output != "json" {
+		return fail("unknown output format %q", output)
+	}
+	setupLogger(verbose)
+
+	ctx := context.Background()
+	c, err := kube.client()
+	if err != nil {
+		return fail("unable to create kubernetes client: %v", err)
+	}
+	checks := utils.NewCheckCache()
+	if err := checks.Refresh(ctx); err != nil {
+		return fail("unable to list health checks: %v", err)
+	}
+
+	result, err := computePlan(ctx, c, checks, kube.namespace)
+	if err != nil {
+		return fail("%v", err)
+	}
+
+	if output == "json" {
+		err = json.NewEncoder(os.Stdout).Encode(result)
+	} else {
+		err = printPlan(os.Stdout, result)
+	}
+	if err != nil {
+		return fail("unable to print plan: %v", err)
+	}
+
+	if len(result.Changes) > 0 {
+		return ExitDrift
+	}
+	return ExitOK
+}
+
+// computePlan diffs the checks the controller derives from the Ingresses against the account
+func computePlan(ctx context.Context, c client.Client, checks *utils.CheckCache, namespace string) (PlanResult, error) {
+	ingresses := &networkingv1.IngressList{}
+	if err := c.List(ctx, ingresses, client.InNamespace(namespace)); err != nil {
+		return PlanResult{}, fmt.Errorf("unable to list ingresses: %w", err)
+	}
+
+	reconciler := &controller.IngressReconciler{Client: c}
+	result := PlanResult{Changes: []Change{}}
+	owners := map[string]bool{}
+	for i := range ingresses.Items {
+		ingress := &ingresses.Items[i]
+		owner := utils.OwnerKey("Ingress", ingress.Namespace, ingress.Name)
+		owners[owner] = true
+
+		ingressInfo, _, err := reconciler.DesiredCheck(ctx, ingress)
+		if errors.Is(err, utils.ErrNoHost) {
+			continue
+		}
+		if errors.Is(err, utils.ErrTemplateNotFound) {
+			// The controller leaves the check alone until the template exists
+			continue
+		}
+		if errors.Is(err, utils.ErrNotMonitored) {
+			// Its check is listed as a deletion below
+			delete(owners, owner)
+			continue
+		}
+		var spec clientsdk.PutApiV1HealthchecksIdJSONRequestBody
+		var hash string
+		if err == nil {
+			spec, hash, err = utils.DesiredSpec(ingressInfo)
+		}
+		if errors.Is(err, utils.ErrInvalidCheck) {
+			// The controller reports it and leaves its check alone
+			result.add(Change{Action: ActionInvalid, Owner: owner, Target: ingressInfo.Target, Reason: err.Error()})
+			continue
+		}
+		if err != nil {
+			return PlanResult{}, fmt.Errorf("%s: %w", owner, err)
+		}
+
+		check, found, err := checks.Find(ingressInfo)
+		switch {
+		case errors.Is(err, utils.ErrAmbiguousMatch):
+			result.add(Change{Action: ActionConflict, Owner: owner, Name: spec.Name, Target: spec.Target,
+				Reason: err.Error()})
+		case err != nil:
+			return PlanResult{}, fmt.Errorf("%s: %w", owner, err)
+		case !found:
+			result.add(Change{Action: ActionCreate, Owner: owner, Name: spec.Name, Target: spec.Target})
+		case check.Labels[utils.SpecHashLabel] != hash:
+			result.add(Change{Action: ActionUpdate, Owner: owner, ID: check.ID, Name: spec.Name,
+				Target: spec.Target, Fields: specChanges(check, spec)})
+		}
+	}
+
+	// Checks owned by Ingresses which no longer exist
+	prefix := "Ingress/"
+	if namespace != "" {
+		prefix = utils.OwnerKey("Ingress", namespace, "")
+	}
+	for _, check := range checks.All() {
+		owner := check.Owner()
+		if !strings.HasPrefix(owner, prefix) || owners[owner] {
+			continue
+		}
+		result.add(Change{Action: ActionDelete, Owner: owner, ID: check.ID, Name: check.Name, Target: check.Target})
+	}
+
+	sort.SliceStable(result.Changes, func(i, j int) bool {
+		return result.Changes[i].Owner < result.Changes[j].Owner
+	})
+	return result, nil
+}
+
+func (p *PlanResult) add(change Change) {
+	p.Changes = append(p.Changes, change)
+	switch change.Action {
+	case ActionCreate:
+		p.Create++
+	case ActionUpdate:
+		p.Update++
+	case ActionDelete:
+		p.Delete++
+	case ActionConflict:
+		p.Conflict++
+	case ActionInvalid:
+		p.Invalid++
+	}
+}
+
+// specChanges lists the settings of the check which differ from the spec
+func specChanges(check utils.RemoteCheck, spec clientsdk.PutApiV1HealthchecksIdJSONRequestBody) []FieldChange {
+	var changes []FieldChange
+	compare := func(field string, old, new interface{}) {
+		if old != new {
+			changes = append(changes, FieldChange{Field: field, Old: old, New: new})
+		}
+	}
+	compare("name", check.Name, spec.Name)
+	compare("description", check.Description, spec.Description)
+	compare("target", check.Target, spec.Target)
+	compare("port", check.Port, spec.Port)
+	compare("protocol", check.Protocol, spec.Protocol)
+	compare("path", check.Path, spec.Path)
+	compare("method", check.Method, spec.Method)
+	compare("timeout", check.Timeout, spec.Timeout)
+	compare("interval", check.Interval, spec.Interval)
+	if spec.Labels != nil {
+		compare("owner", check.Owner(), (*spec.Labels)[utils.OwnerLabel])
+	}
+	return changes
+}
+
+var actionSymbols = map[string]string{
+	ActionCreate:   "+",
+	ActionUpdate:   "~",
+	ActionDelete:   "-",
+	ActionConflict: "!",
+	ActionInvalid:  "?",
+}
+
+// printPlan writes the plan in a human readable form
+func printPlan(w io.Writer, result PlanResult) error {
+	if len(result.Changes) == 0 {
+		_, err := fmt.Fprintln(w, "No changes. The health checks match the cluster.")
+		return err
+	}
+
+	for _, change := range result.Changes {
+		line := fmt.Sprintf("  %s %s %s (%s)", actionSymbols[change.Action], change.Action, change.Owner, change.Target)
+		if change.ID != "" {
+			line += fmt.Sprintf(" id=%s", change.ID)
+		}
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+		if change.Reason != "" {
+			if _, err := fmt.Fprintf(w, "      %s\n", change.Reason); err != nil {
+				return err
+			}
+		}
+		if change.Action == ActionUpdate && len(change.Fields) == 0 {
+			if _, err := fmt.Fprintln(w, "      settings not returned by the API, such as enabled or success codes"); err != nil {
+				return err
+			}
+		}
+		for _, field := range change.Fields {
+			if _, err := fmt.Fprintf(w, "      %s: %v => %v\n", field.Field, field.Old, field.New); err != nil {
+				return err
+			}
+		}
+	}
+
+	_, err := fmt.Fprintf(w, "\nPlan: %d to create, %d to update, %d to delete.\n",
+		result.Create, result.Update, result.Delete)
+	if err == nil && result.Conflict > 0 {
+		_, err = fmt.Fprintf(w, "%d ingresses match several health checks, see agent import.\n", result.Conflict)
+	}
+	if err == nil && result.Invalid > 0 {
+		_, err = fmt.Fprintf(w, "%d ingresses have invalid health check settings, see agent lint.\n", result.Invalid)
+	}
+	return err
+}
@@ -0,0 +1,137 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	monitoringv1alpha1 "github.com/wentidev/agent/api/v1alpha1"
+	"github.com/wentidev/agent/internal/utils"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func newIngress(name, host string, annotations map[string]string) *networkingv1.Ingress {
+	return &networkingv1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", Annotations: annotations},
+		Spec: networkingv1.IngressSpec{
+			Rules: []networkingv1.IngressRule{{Host: host}},
+		},
+	}
+}
+
+// remoteCheck returns the check the controller would have written for the ingress
+func remoteCheck(id string, ingress *networkingv1.Ingress) utils.RemoteCheck {
+	info, err := utils.IngressInfoFromIngress(ingress)
+	Expect(err).NotTo(HaveOccurred())
+	spec, _, err := utils.DesiredSpec(info)
+	Expect(err).NotTo(HaveOccurred())
+	labels := map[string]string{}
+	for key, value := range *spec.Labels {
+		labels[key] = value.(string)
+	}
+	return utils.RemoteCheck{
+		ID: id, Name: spec.Name, Description: spec.Description, Target: spec.Target, Port: spec.Port,
+		Protocol: spec.Protocol, Path: spec.Path, Method: spec.Method, Timeout: spec.Timeout,
+		Interval: spec.Interval, Labels: labels,
+	}
+}
+
+var _ = Describe("Plan", func() {
+	It("should diff the ingresses against the account", func() {
+		unchanged := newIngress("unchanged", "unchanged.example.com", nil)
+		updated := newIngress("updated", "updated.example.com", nil)
+		created := newIngress("created", "created.example.com", nil)
+		deleted := newIngress("deleted", "deleted.example.com", nil)
+
+		checks := utils.NewCheckCache()
+		checks.Put(remoteCheck("1", unchanged))
+		checks.Put(remoteCheck("2", updated))
+		checks.Put(remoteCheck("3", deleted))
+		updated.Annotations = map[string]string{utils.HealthCheckInterval: "10"}
+
+		c := fake.NewClientBuilder().WithObjects(unchanged, updated, created).Build()
+		result, err := computePlan(context.Background(), c, checks, "")
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(result.Create).To(Equal(1))
+		Expect(result.Update).To(Equal(1))
+		Expect(result.Delete).To(Equal(1))
+		Expect(result.Changes).To(HaveLen(3))
+		Expect(result.Changes[0].Owner).To(Equal(utils.OwnerKey("Ingress", "default", "created")))
+		Expect(result.Changes[1].ID).To(Equal("3"))
+		Expect(result.Changes[2].Fields).To(ConsistOf(FieldChange{Field: "interval", Old: 60, New: 10}))
+
+		out := &bytes.Buffer{}
+		Expect(printPlan(out, result)).To(Succeed())
+		Expect(out.String()).To(ContainSubstring("Plan: 1 to create, 1 to update, 1 to delete."))
+	})
+
+	It("should report no changes when in sync", func() {
+		ingress := newIngress("web", "example.com", nil)
+		checks := utils.NewCheckCache()
+		checks.Put(remoteCheck("1", ingress))
+
+		c := fake.NewClientBuilder().WithObjects(ingress).Build()
+		result, err := computePlan(context.Background(), c, checks, "")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.Changes).To(BeEmpty())
+	})
+
+	It("should diff against the checks clamped to the policies", func() {
+		checks := utils.NewCheckCache()
+		checks.Put(remoteCheck("1", newIngress("web", "example.com", nil)))
+		ingress := newIngress("web", "example.com", map[string]string{utils.HealthCheckInterval: "10"})
+		policy := &monitoringv1alpha1.HealthCheckPolicy{
+			ObjectMeta: metav1.ObjectMeta{Name: "floor", Namespace: "default"},
+			Spec:       monitoringv1alpha1.HealthCheckPolicySpec{MinInterval: &metav1.Duration{Duration: time.Minute}},
+		}
+
+		c := fake.NewClientBuilder().WithObjects(ingress, policy).Build()
+		result, err := computePlan(context.Background(), c, checks, "")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.Changes).To(BeEmpty())
+	})
+
+	It("should report invalid ingresses and plan the others", func() {
+		valid := newIngress("web", "web.example.com", nil)
+		invalid := newIngress("api", "api.example.com", map[string]string{utils.HealthCheckMethod: "FETCH"})
+		checks := utils.NewCheckCache()
+		checks.Put(remoteCheck("1", newIngress("api", "api.example.com", nil)))
+
+		c := fake.NewClientBuilder().WithObjects(valid, invalid).Build()
+		result, err := computePlan(context.Background(), c, checks, "")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.Create).To(Equal(1))
+		Expect(result.Invalid).To(Equal(1))
+		Expect(result.Delete).To(BeZero())
+		Expect(result.Changes).To(ConsistOf(
+			HaveField("Owner", utils.OwnerKey("Ingress", "default", "web")),
+			And(HaveField("Action", ActionInvalid), HaveField("Reason", ContainSubstring("FETCH"))),
+		))
+
+		out := &bytes.Buffer{}
+		Expect(printPlan(out, result)).To(Succeed())
+		Expect(out.String()).To(ContainSubstring("1 ingresses have invalid health check settings"))
+	})
+})
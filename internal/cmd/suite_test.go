@@ -0,0 +1,37 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	monitoringv1alpha1 "github.com/wentidev/agent/api/v1alpha1"
+	"k8s.io/client-go/kubernetes/scheme"
+)
+
+func TestCmd(t *testing.T) {
+	RegisterFailHandler(Fail)
+
+	RunSpecs(t, "Cmd Suite")
+}
+
+var _ = BeforeSuite(func() {
+	Expect(monitoringv1alpha1.AddToScheme(scheme.Scheme)).To(Succeed())
+})
@@ -0,0 +1,56 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	"github.com/wentidev/agent/internal/utils"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// reportAmbiguousMatch surfaces an object whose check matches several unmanaged checks. The
+// controller neither adopts one nor creates a duplicate until a human sets the
+// wenti.dev/health-check-id annotation or removes the extra checks.
+func reportAmbiguousMatch(recorder record.EventRecorder, obj client.Object, err error) {
+	log.Log.Info("ambiguous health check match, set the id annotation to resolve it",
+		"object", client.ObjectKeyFromObject(obj), "reason", err.Error(), "annotation", utils.HealthCheckID)
+	if recorder != nil {
+		recorder.Eventf(obj, corev1.EventTypeWarning, "AmbiguousHealthCheck",
+			"%v, set the %s annotation to the check to adopt", err, utils.HealthCheckID)
+	}
+}
+
+// recordCheckID records the ID of the check owned by the ingress in the wenti.dev/health-check-id
+// annotation, so that the check is still found if its ownership labels are lost
+func (r *IngressReconciler) recordCheckID(ctx context.Context, ingress *networkingv1.Ingress, ingressInfo utils.IngressInfo) error {
+	checks := utils.Checks.ByOwner(ingressInfo.Owner)
+	if len(checks) == 0 || utils.GetStringAnnotation(ingress, utils.HealthCheckID) == checks[0].ID {
+		return nil
+	}
+
+	patch := client.MergeFrom(ingress.DeepCopy())
+	if ingress.Annotations == nil {
+		ingress.Annotations = map[string]string{}
+	}
+	ingress.Annotations[utils.HealthCheckID] = checks[0].ID
+	return r.Patch(ctx, ingress, patch)
+}
@@ -0,0 +1,96 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+
+	. "github.com/onsi/ginkgo/v2"
+
+	"github.com/wentidev/agent/internal/utils"
+)
+
+// apiCalls records the requests received by the fake Wenti API
+type apiCalls struct {
+	mu    sync.Mutex
+	calls []string
+}
+
+func (a *apiCalls) record(r *http.Request) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.calls = append(a.calls, r.Method+" "+r.URL.Path)
+}
+
+func (a *apiCalls) get() []string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return append([]string(nil), a.calls...)
+}
+
+var (
+	apiOnce    sync.Once
+	apiMu      sync.Mutex
+	apiCurrent *apiCalls
+	apiIDs     int
+)
+
+// fakeAPI points the shared client at a fake Wenti API without any check, which creates
+// and deletes whatever it is asked to, and gives the test a fresh check cache. The client
+// is created once per process, so a single server serves every test.
+func fakeAPI() *apiCalls {
+	apiOnce.Do(func() {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			apiMu.Lock()
+			calls := apiCurrent
+			apiIDs++
+			id := apiIDs
+			apiMu.Unlock()
+			if calls != nil {
+				calls.record(r)
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			switch r.Method {
+			case http.MethodGet:
+				_ = json.NewEncoder(w).Encode(map[string]interface{}{"http-checks": []interface{}{}})
+			case http.MethodPost:
+				w.WriteHeader(http.StatusCreated)
+				_ = json.NewEncoder(w).Encode(map[string]string{"id": fmt.Sprint(id)})
+			default:
+				w.WriteHeader(http.StatusNoContent)
+			}
+		}))
+		utils.AppURL = server.URL
+	})
+
+	calls := &apiCalls{}
+	checks := utils.Checks
+	apiMu.Lock()
+	apiCurrent, utils.Checks = calls, utils.NewCheckCache()
+	apiMu.Unlock()
+	DeferCleanup(func() {
+		apiMu.Lock()
+		defer apiMu.Unlock()
+		apiCurrent, utils.Checks = nil, checks
+	})
+	return calls
+}
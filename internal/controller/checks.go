@@ -0,0 +1,118 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/wentidev/agent/internal/metrics"
+	"github.com/wentidev/agent/internal/utils"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// reconcileChecks syncs the checks of obj, clamped by applyPolicy, with the server and reports
+// whether they were written. It leaves them alone if one is invalid or matches several
+// unmanaged checks, and deletes them if they exceed the quota of the namespace.
+func reconcileChecks(ctx context.Context, c client.Reader, recorder record.EventRecorder, obj client.Object,
+	owner string, checks []utils.IngressInfo) (bool, error) {
+	for _, check := range checks {
+		if _, _, err := utils.DesiredSpec(check); err != nil {
+			return false, reportInvalidCheck(recorder, obj, err)
+		}
+	}
+
+	// Hold the namespace so that concurrent reconciles do not both fit in its quota
+	defer utils.LockNamespace(obj.GetNamespace())()
+	err := enforcePolicy(ctx, c, recorder, obj, owner, checks)
+	if errors.Is(err, utils.ErrPolicyViolation) {
+		if _, err := utils.SyncHealthChecks(ctx, owner, nil); err != nil {
+			return false, err
+		}
+		metrics.ForgetManagedCheck(owner)
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	statuses, err := utils.SyncHealthChecks(ctx, owner, checks)
+	if errors.Is(err, utils.ErrAmbiguousMatch) {
+		reportAmbiguousMatch(recorder, obj, err)
+		return false, nil
+	}
+	if err != nil {
+		return false, reportInvalidCheck(recorder, obj, err)
+	}
+	log.Log.Info("health check response", "owner", owner, "Status", statuses)
+	reportDryRun(recorder, obj, owner, checks, statuses)
+
+	states := make(map[string]string, len(checks))
+	for _, check := range checks {
+		states[check.Key] = checkState(check)
+	}
+	metrics.SetManagedChecks(owner, states)
+	return true, nil
+}
+
+// reportDryRun surfaces the writes skipped in dry-run mode as Normal Events. The statuses
+// of SyncHealthChecks follow the desired checks, then the deletions of the other ones.
+func reportDryRun(recorder record.EventRecorder, obj client.Object, owner string, checks []utils.IngressInfo,
+	statuses []string) {
+	if !utils.DryRun || recorder == nil {
+		return
+	}
+	for i, status := range statuses {
+		switch {
+		case !strings.HasPrefix(status, "would "):
+		case i < len(checks):
+			recorder.Eventf(obj, corev1.EventTypeNormal, "DryRun", "Dry run: %s health check %s for %s",
+				status, checks[i].Name, checks[i].Target)
+		default:
+			recorder.Eventf(obj, corev1.EventTypeNormal, "DryRun", "Dry run: %s a health check no longer derived from %s",
+				status, owner)
+		}
+	}
+}
+
+// reportInvalidCheck surfaces the settings of obj the agent cannot turn into a check as a
+// Warning Event. Retrying does not help until obj changes, so it only returns the other errors.
+func reportInvalidCheck(recorder record.EventRecorder, obj client.Object, err error) error {
+	if !errors.Is(err, utils.ErrInvalidCheck) {
+		return err
+	}
+	log.Log.Info("invalid health check", "namespace", obj.GetNamespace(), "name", obj.GetName(), "reason", err.Error())
+	if recorder != nil {
+		recorder.Eventf(obj, corev1.EventTypeWarning, "InvalidHealthCheck", "%v", err)
+	}
+	return nil
+}
+
+// dropChecks deletes the checks of an owner which is gone or no longer monitored
+func dropChecks(ctx context.Context, owner string) error {
+	if _, err := utils.SyncHealthChecks(ctx, owner, nil); err != nil {
+		log.Log.Error(err, "unable to delete health checks", "owner", owner)
+		return err
+	}
+	metrics.ForgetManagedCheck(owner)
+	forgetViolations(owner)
+	return nil
+}
@@ -0,0 +1,113 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"errors"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/wentidev/agent/internal/metrics"
+	"github.com/wentidev/agent/internal/utils"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+var _ = Describe("Invalid checks", func() {
+	key := types.NamespacedName{Namespace: "shop", Name: "web"}
+
+	It("should only return the errors retrying may fix", func() {
+		recorder := record.NewFakeRecorder(10)
+		ingress := &networkingv1.Ingress{ObjectMeta: metav1.ObjectMeta{Name: key.Name, Namespace: key.Namespace}}
+		unavailable := errors.New("unexpected status code 503")
+		Expect(reportInvalidCheck(recorder, ingress, unavailable)).To(MatchError(unavailable))
+		Expect(recorder.Events).NotTo(Receive())
+	})
+
+	It("should report an Ingress with invalid settings without requeueing it", func() {
+		calls := fakeAPI()
+		ingress := &networkingv1.Ingress{
+			ObjectMeta: metav1.ObjectMeta{Name: key.Name, Namespace: key.Namespace,
+				Annotations: map[string]string{utils.HealthCheckMethod: "FETCH"}},
+			Spec: networkingv1.IngressSpec{Rules: []networkingv1.IngressRule{{Host: "web.example.com"}}},
+		}
+		recorder := record.NewFakeRecorder(10)
+		r := &IngressReconciler{
+			Client: fake.NewClientBuilder().WithObjects(ingress).
+				WithIndex(&networkingv1.Ingress{}, backendServiceIndex, indexBackendServices).Build(),
+			Recorder: recorder,
+		}
+
+		result, err := r.Reconcile(context.Background(), reconcile.Request{NamespacedName: key})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.RequeueAfter).To(BeZero())
+		Expect(recorder.Events).To(Receive(And(ContainSubstring("InvalidHealthCheck"), ContainSubstring("FETCH"))))
+		Expect(calls.get()).To(BeEmpty())
+	})
+
+	It("should report a name template failing to render without requeueing", func() {
+		calls := fakeAPI()
+		names, err := utils.CompileNames(utils.NameConfig{Name: "{{ .Missing }}"})
+		Expect(err).NotTo(HaveOccurred())
+		utils.Names = names
+		DeferCleanup(func() { utils.Names = nil })
+		ingress := &networkingv1.Ingress{
+			ObjectMeta: metav1.ObjectMeta{Name: key.Name, Namespace: key.Namespace},
+			Spec:       networkingv1.IngressSpec{Rules: []networkingv1.IngressRule{{Host: "web.example.com"}}},
+		}
+		recorder := record.NewFakeRecorder(10)
+		r := &IngressReconciler{
+			Client: fake.NewClientBuilder().WithObjects(ingress).
+				WithIndex(&networkingv1.Ingress{}, backendServiceIndex, indexBackendServices).Build(),
+			Recorder: recorder,
+		}
+
+		result, err := r.Reconcile(context.Background(), reconcile.Request{NamespacedName: key})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.RequeueAfter).To(BeZero())
+		Expect(recorder.Events).To(Receive(And(ContainSubstring("InvalidHealthCheck"), ContainSubstring("Missing"))))
+		Expect(calls.get()).To(BeEmpty())
+	})
+	It("should report the writes an Ingress skips in dry-run mode", func() {
+		calls := fakeAPI()
+		utils.DryRun = true
+		DeferCleanup(func() { utils.DryRun = false })
+		owner := utils.OwnerKey("Ingress", key.Namespace, key.Name)
+		DeferCleanup(metrics.ForgetManagedCheck, owner)
+		ingress := &networkingv1.Ingress{
+			ObjectMeta: metav1.ObjectMeta{Name: key.Name, Namespace: key.Namespace},
+			Spec:       networkingv1.IngressSpec{Rules: []networkingv1.IngressRule{{Host: "web.example.com"}}},
+		}
+		recorder := record.NewFakeRecorder(10)
+		r := &IngressReconciler{
+			Client: fake.NewClientBuilder().WithObjects(ingress).
+				WithIndex(&networkingv1.Ingress{}, backendServiceIndex, indexBackendServices).Build(),
+			Recorder: recorder,
+		}
+
+		_, err := r.Reconcile(context.Background(), reconcile.Request{NamespacedName: key})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(recorder.Events).To(Receive(And(ContainSubstring("DryRun"), ContainSubstring("would create"))))
+		Expect(calls.get()).NotTo(ContainElement(HavePrefix("POST")))
+	})
+})
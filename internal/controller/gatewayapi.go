@@ -0,0 +1,75 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	"github.com/wentidev/agent/internal/utils"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// gatewayRouteChecks builds the checks of a Gateway API route on the listeners of its parent Gateways
+func gatewayRouteChecks(ctx context.Context, c client.Reader, route *unstructured.Unstructured) ([]utils.IngressInfo, error) {
+	gateways := map[types.NamespacedName]*unstructured.Unstructured{}
+	for _, parent := range utils.GatewayParents(route) {
+		if _, ok := gateways[parent.NamespacedName]; ok {
+			continue
+		}
+		gateway := &unstructured.Unstructured{}
+		gateway.SetGroupVersionKind(utils.GatewayGVK)
+		err := c.Get(ctx, parent.NamespacedName, gateway)
+		if apierrors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		gateways[parent.NamespacedName] = gateway
+	}
+	return utils.GatewayRouteChecks(route, gateways)
+}
+
+// routesForGateway maps a Gateway to the routes of the kind attached to it
+func routesForGateway(gvk schema.GroupVersionKind) MapFunc {
+	return func(ctx context.Context, c client.Reader, obj client.Object) []reconcile.Request {
+		list := &unstructured.UnstructuredList{}
+		list.SetGroupVersionKind(gvk.GroupVersion().WithKind(gvk.Kind + "List"))
+		if err := c.List(ctx, list); err != nil {
+			return nil
+		}
+
+		gateway := types.NamespacedName{Namespace: obj.GetNamespace(), Name: obj.GetName()}
+		var requests []reconcile.Request
+		for i := range list.Items {
+			for _, parent := range utils.GatewayParents(&list.Items[i]) {
+				if parent.NamespacedName == gateway {
+					requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{
+						Namespace: list.Items[i].GetNamespace(), Name: list.Items[i].GetName(),
+					}})
+					break
+				}
+			}
+		}
+		return requests
+	}
+}
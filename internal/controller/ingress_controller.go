@@ -18,82 +18,246 @@ package controller
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
 
+	monitoringv1alpha1 "github.com/wentidev/agent/api/v1alpha1"
+	"github.com/wentidev/agent/internal/metrics"
+	"github.com/wentidev/agent/internal/tracing"
 	"github.com/wentidev/agent/internal/utils"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
 	networkingv1 "k8s.io/api/networking/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
 )
 
 // IngressReconciler reconciles a Ingress object
 type IngressReconciler struct {
 	client.Client
-	Scheme *runtime.Scheme
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
+
+	// MaxConcurrentReconciles is the number of Ingresses reconciled in parallel
+	MaxConcurrentReconciles int
+	// Debounce delays the reconcile of an updated Ingress until it saw no update for that long
+	Debounce time.Duration
+
+	// maintenance tracks whether each ingress was last seen in a maintenance window
+	maintenance sync.Map
+	// lastUpdate records when each ingress was last updated, for debouncing
+	lastUpdate sync.Map
+	// synced holds the last check synced for each ingress, whose status the poller reflects
+	synced sync.Map
+	// statusUnsupported is set once the server turned out not to report the state of its checks
+	statusUnsupported atomic.Bool
 }
 
 // +kubebuilder:rbac:groups=networking.k8s.io,resources=ingresses,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=networking.k8s.io,resources=ingresses/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=networking.k8s.io,resources=ingresses/finalizers,verbs=update
+// +kubebuilder:rbac:groups=discovery.k8s.io,resources=endpointslices,verbs=get;list;watch
+// +kubebuilder:rbac:groups=core,resources=services,verbs=get;list;watch
+// +kubebuilder:rbac:groups=core,resources=namespaces,verbs=get;list;watch
+// +kubebuilder:rbac:groups=core,resources=events,verbs=create;patch
+// +kubebuilder:rbac:groups=apps,resources=deployments;statefulsets,verbs=get;list;watch
+// +kubebuilder:rbac:groups=monitoring.wenti.dev,resources=healthchecktemplates;clusterhealthchecktemplates,verbs=get;list;watch
+// +kubebuilder:rbac:groups=monitoring.wenti.dev,resources=healthcheckpolicies;clusterhealthcheckpolicies,verbs=get;list;watch
 
-func (r *IngressReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+func (r *IngressReconciler) Reconcile(ctx context.Context, req ctrl.Request) (result ctrl.Result, err error) {
 	_ = log.FromContext(ctx)
+	if wait := r.debounceRemaining(req.NamespacedName); wait > 0 {
+		return ctrl.Result{RequeueAfter: wait}, nil
+	}
+
+	ctx, span := tracing.Tracer().Start(ctx, "Reconcile Ingress", trace.WithAttributes(
+		attribute.String("k8s.namespace.name", req.Namespace),
+		attribute.String("k8s.ingress.name", req.Name),
+	))
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, "reconcile failed")
+		}
+		span.End()
+		metrics.ObserveReconcile(req.Namespace, err)
+	}()
 
 	// Retrieve the ingress object
 	ingress := &networkingv1.Ingress{}
-	err := r.Get(ctx, req.NamespacedName, ingress)
+	err = r.Get(ctx, req.NamespacedName, ingress)
 	if err != nil {
-		_, err := utils.DeleteHealthCheck(utils.IngressInfo{
-			Name: fmt.Sprintf("%s_%s", req.Namespace, req.Name),
+		_, err := utils.DeleteHealthCheck(ctx, utils.IngressInfo{
+			Name:  fmt.Sprintf("%s_%s", req.Namespace, req.Name),
+			Owner: utils.OwnerKey("Ingress", req.Namespace, req.Name),
 		})
 		if err != nil {
 			log.Log.Error(err, "unable to delete health check")
 			return ctrl.Result{}, err
 		}
+		r.forgetStatus(req.NamespacedName)
+		r.maintenance.Delete(req.NamespacedName)
+		metrics.ForgetManagedCheck(utils.OwnerKey("Ingress", req.Namespace, req.Name))
+		forgetViolations(utils.OwnerKey("Ingress", req.Namespace, req.Name))
 		log.Log.Info("ingress is being deleted")
 		return ctrl.Result{}, client.IgnoreNotFound(err)
 	}
 
-	ingressInfo := utils.NewIngressInfo()
-	ingressInfo.Name = fmt.Sprintf("%s_%s", ingress.Namespace, ingress.Name)
-	ingressInfo.Description = fmt.Sprintf("%s_%s", ingress.Namespace, ingress.Name)
-	ingressInfo.Target = ingress.Spec.Rules[0].Host
-	if utils.GetStringAnnotation(ingress, utils.HealthCheckPort) != "" {
-		ingressInfo.Port = utils.GetStringAnnotation(ingress, utils.HealthCheckPort)
+	ingressInfo, maintenance, err := r.DesiredCheck(ctx, ingress)
+	if errors.Is(err, utils.ErrNoHost) {
+		log.Log.Info("ingress has no host to monitor", "ingress", req.NamespacedName)
+		return ctrl.Result{}, nil
+	}
+	if errors.Is(err, utils.ErrTemplateNotFound) {
+		r.reportMissingTemplate(ingress, err)
+		return ctrl.Result{}, nil
+	}
+	if errors.Is(err, utils.ErrNotMonitored) {
+		log.Log.Info("ingress opted out by a rule, deleting its health check", "ingress", req.NamespacedName)
+		if _, err := utils.DeleteHealthCheck(ctx, utils.IngressInfo{
+			Name:  fmt.Sprintf("%s_%s", req.Namespace, req.Name),
+			Owner: utils.OwnerKey("Ingress", req.Namespace, req.Name),
+		}); err != nil {
+			return ctrl.Result{}, err
+		}
+		r.forgetStatus(req.NamespacedName)
+		metrics.ForgetManagedCheck(utils.OwnerKey("Ingress", req.Namespace, req.Name))
+		forgetViolations(utils.OwnerKey("Ingress", req.Namespace, req.Name))
+		return ctrl.Result{}, nil
 	}
-	if utils.GetStringAnnotation(ingress, utils.HealthCheckProtocol) != "" {
-		ingressInfo.Protocol = utils.GetStringAnnotation(ingress, utils.HealthCheckProtocol)
+	if err != nil {
+		return ctrl.Result{}, reportInvalidCheck(r.Recorder, ingress, err)
 	}
-	if utils.GetStringAnnotation(ingress, utils.HealthCheckPath) != "" {
-		ingressInfo.Path = utils.GetStringAnnotation(ingress, utils.HealthCheckPath)
+
+	synced, err := reconcileChecks(ctx, r.Client, r.Recorder, ingress, ingressInfo.Owner, []utils.IngressInfo{ingressInfo})
+	if err != nil {
+		return ctrl.Result{}, err
 	}
-	if utils.GetStringAnnotation(ingress, utils.HealthCheckMethod) != "" {
-		ingressInfo.Method = utils.GetStringAnnotation(ingress, utils.HealthCheckMethod)
+	if !synced {
+		r.forgetStatus(req.NamespacedName)
+		return ctrl.Result{}, nil
 	}
-	if utils.GetStringAnnotation(ingress, utils.HealthCheckHTTPCode) != "" {
-		ingressInfo.HTTPCode = utils.GetStringAnnotation(ingress, utils.HealthCheckHTTPCode)
+	if utils.Adopt && !utils.DryRun {
+		if err := r.recordCheckID(ctx, ingress, ingressInfo); err != nil {
+			log.Log.Error(err, "unable to record health check id")
+		}
 	}
-	if utils.GetStringAnnotation(ingress, utils.HealthCheckTimeout) != "" {
-		ingressInfo.Timeout = utils.GetStringAnnotation(ingress, utils.HealthCheckTimeout)
+	recordMaintenance(r.Recorder, &r.maintenance, ingress, maintenance)
+
+	if utils.StatusPollInterval > 0 && !r.statusUnsupported.Load() {
+		// The status poller refreshes it from then on, without reconciling the ingress again
+		r.synced.Store(req.NamespacedName, ingressInfo)
+		if err := r.reflectStatus(ctx, ingress, ingressInfo); err != nil {
+			log.Log.Error(err, "unable to reflect health check status")
+		}
 	}
-	if utils.GetStringAnnotation(ingress, utils.HealthCheckInterval) != "" {
-		ingressInfo.Interval = utils.GetStringAnnotation(ingress, utils.HealthCheckInterval)
+
+	// Come back when the maintenance window starts or ends
+	if !maintenance.NextTransition.IsZero() {
+		result.RequeueAfter = time.Until(maintenance.NextTransition)
 	}
+	return result, nil
+}
 
-	check, err := utils.CreateOrUpdateHealthCheck(ingressInfo)
+// DesiredCheck builds the health check of the ingress from the rules, its template and its annotations, clamped to the
+// policies of its namespace and disabled while its backends are scaled down or a maintenance window is active, and returns
+// the maintenance state
+func (r *IngressReconciler) DesiredCheck(ctx context.Context, ingress *networkingv1.Ingress) (utils.IngressInfo, utils.Maintenance, error) {
+	var namespace *corev1.Namespace
+	if len(utils.Rules) > 0 {
+		namespace = &corev1.Namespace{}
+		if err := r.Get(ctx, types.NamespacedName{Name: ingress.Namespace}, namespace); err != nil {
+			return utils.IngressInfo{}, utils.Maintenance{}, err
+		}
+	}
+	template, err := resolveTemplate(ctx, r.Client, ingress)
 	if err != nil {
-		return ctrl.Result{}, err
+		return utils.IngressInfo{}, utils.Maintenance{}, err
+	}
+	ingressInfo, err := utils.IngressInfoWithSettings(ingress, utils.IngressSettings{
+		Namespace: namespace, Rules: utils.Rules, Template: template,
+	})
+	if err != nil {
+		return utils.IngressInfo{}, utils.Maintenance{}, err
+	}
+	key := types.NamespacedName{Namespace: ingress.Namespace, Name: ingress.Name}
+
+	// Disable the check while the backends are intentionally scaled to zero
+	scaledDown, err := r.isScaledDown(ctx, ingress)
+	if err != nil {
+		log.Log.Error(err, "unable to determine backend endpoints")
+		return utils.IngressInfo{}, utils.Maintenance{}, err
+	}
+	if scaledDown {
+		log.Log.Info("backends are scaled down, disabling health check", "ingress", key)
+		ingressInfo.Enabled = false
 	}
-	log.Log.Info("health check response", "Status", check)
-	return ctrl.Result{}, nil
+
+	// Disable the check during maintenance windows of the ingress or its namespace
+	maintenance, err := maintenanceState(ctx, r.Client, r.Recorder, ingress)
+	if err != nil {
+		log.Log.Error(err, "unable to determine maintenance window")
+		return utils.IngressInfo{}, utils.Maintenance{}, err
+	}
+	if maintenance.Active {
+		log.Log.Info("maintenance in progress, disabling health check", "ingress", key,
+			"until", maintenance.NextTransition)
+		ingressInfo.Enabled = false
+	}
+
+	checks := []utils.IngressInfo{ingressInfo}
+	if err := applyPolicy(ctx, r.Client, ingress.Namespace, checks); err != nil {
+		return utils.IngressInfo{}, utils.Maintenance{}, err
+	}
+	return checks[0], maintenance, nil
 }
 
 // SetupWithManager sets up the controller with the Manager.
 func (r *IngressReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &networkingv1.Ingress{},
+		backendServiceIndex, indexBackendServices); err != nil {
+		return err
+	}
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &networkingv1.Ingress{},
+		templateIndex, indexTemplate); err != nil {
+		return err
+	}
+	if utils.StatusPollInterval > 0 {
+		if err := mgr.Add(r.statusPoller(utils.StatusPollInterval)); err != nil {
+			return err
+		}
+	}
+
 	return ctrl.NewControllerManagedBy(mgr).
-		For(&networkingv1.Ingress{}).
+		Watches(&networkingv1.Ingress{}, r.debouncedHandler(), builder.WithPredicates(ingressPredicates())).
+		Watches(&discoveryv1.EndpointSlice{}, handler.EnqueueRequestsFromMapFunc(r.ingressesForEndpointSlice)).
+		Watches(&appsv1.Deployment{}, handler.EnqueueRequestsFromMapFunc(r.ingressesForWorkload),
+			builder.WithPredicates(workloadScaledDownPredicate())).
+		Watches(&appsv1.StatefulSet{}, handler.EnqueueRequestsFromMapFunc(r.ingressesForWorkload),
+			builder.WithPredicates(workloadScaledDownPredicate())).
+		Watches(&corev1.Namespace{}, handler.EnqueueRequestsFromMapFunc(r.ingressesForNamespace),
+			builder.WithPredicates(predicate.Or(predicate.AnnotationChangedPredicate{}, predicate.LabelChangedPredicate{}))).
+		Watches(&monitoringv1alpha1.HealthCheckTemplate{}, handler.EnqueueRequestsFromMapFunc(r.ingressesForTemplate)).
+		Watches(&monitoringv1alpha1.ClusterHealthCheckTemplate{},
+			handler.EnqueueRequestsFromMapFunc(r.ingressesForClusterTemplate)).
+		Watches(&monitoringv1alpha1.HealthCheckPolicy{}, policyHandler(r.ingressesForNamespace)).
+		Watches(&monitoringv1alpha1.ClusterHealthCheckPolicy{}, policyHandler(r.ingressesForNamespace)).
 		Named("ingress").
+		WithOptions(controller.Options{MaxConcurrentReconciles: r.MaxConcurrentReconciles}).
 		Complete(r)
 }
@@ -0,0 +1,108 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	"github.com/wentidev/agent/internal/utils"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// virtualServiceChecks builds the checks of a VirtualService on the externally exposed
+// Gateways it is bound to
+func virtualServiceChecks(ctx context.Context, c client.Reader, vs *unstructured.Unstructured) ([]utils.IngressInfo, error) {
+	refs := utils.GatewayRefs(vs)
+	if len(refs) == 0 {
+		return nil, utils.ErrNoHost
+	}
+
+	services := &corev1.ServiceList{}
+	if err := c.List(ctx, services); err != nil {
+		return nil, err
+	}
+	var gateways []*unstructured.Unstructured
+	for _, ref := range refs {
+		gateway := &unstructured.Unstructured{}
+		gateway.SetGroupVersionKind(utils.IstioGatewayGVK)
+		err := c.Get(ctx, ref, gateway)
+		if apierrors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if utils.GatewayExposed(gateway, services.Items) {
+			gateways = append(gateways, gateway)
+		}
+	}
+	if len(gateways) == 0 {
+		return nil, utils.ErrNoHost
+	}
+	return utils.VirtualServiceChecks(vs, gateways)
+}
+
+// virtualServicesForGateway maps a Gateway to the VirtualServices bound to it
+func virtualServicesForGateway(ctx context.Context, c client.Reader, obj client.Object) []reconcile.Request {
+	list := &unstructured.UnstructuredList{}
+	list.SetGroupVersionKind(utils.VirtualServiceGVK.GroupVersion().WithKind(utils.VirtualServiceGVK.Kind + "List"))
+	if err := c.List(ctx, list); err != nil {
+		return nil
+	}
+
+	gateway := types.NamespacedName{Namespace: obj.GetNamespace(), Name: obj.GetName()}
+	var requests []reconcile.Request
+	for i := range list.Items {
+		for _, ref := range utils.GatewayRefs(&list.Items[i]) {
+			if ref == gateway {
+				requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{
+					Namespace: list.Items[i].GetNamespace(), Name: list.Items[i].GetName(),
+				}})
+				break
+			}
+		}
+	}
+	return requests
+}
+
+// virtualServicesForService maps a Service to the VirtualServices bound to the Gateways whose
+// pods it selects, as whether it is a LoadBalancer decides if they are exposed
+func virtualServicesForService(ctx context.Context, c client.Reader, obj client.Object) []reconcile.Request {
+	service, ok := obj.(*corev1.Service)
+	if !ok || len(service.Spec.Selector) == 0 {
+		return nil
+	}
+	gateways := &unstructured.UnstructuredList{}
+	gateways.SetGroupVersionKind(utils.IstioGatewayGVK.GroupVersion().WithKind(utils.IstioGatewayGVK.Kind + "List"))
+	if err := c.List(ctx, gateways); err != nil {
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for i := range gateways.Items {
+		gatewaySelector, _, _ := unstructured.NestedStringMap(gateways.Items[i].Object, "spec", "selector")
+		if len(gatewaySelector) > 0 && utils.SelectorsOverlap(service.Spec.Selector, gatewaySelector) {
+			requests = append(requests, virtualServicesForGateway(ctx, c, &gateways.Items[i])...)
+		}
+	}
+	return requests
+}
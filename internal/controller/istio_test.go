@@ -0,0 +1,85 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/wentidev/agent/internal/utils"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+var _ = Describe("Istio mapping", func() {
+	newObject := func(gvk schema.GroupVersionKind, namespace, name string, spec map[string]interface{}) *unstructured.Unstructured {
+		obj := &unstructured.Unstructured{Object: map[string]interface{}{"spec": spec}}
+		obj.SetGroupVersionKind(gvk)
+		obj.SetNamespace(namespace)
+		obj.SetName(name)
+		return obj
+	}
+
+	It("should map LoadBalancer Services to the VirtualServices of the Gateways they select", func() {
+		c := fake.NewClientBuilder().WithObjects(
+			newObject(utils.IstioGatewayGVK, "istio-system", "public", map[string]interface{}{
+				"selector": map[string]interface{}{"istio": "ingressgateway"},
+			}),
+			newObject(utils.IstioGatewayGVK, "istio-system", "internal", map[string]interface{}{
+				"selector": map[string]interface{}{"istio": "internalgateway"},
+			}),
+			newObject(utils.VirtualServiceGVK, "shop", "web", map[string]interface{}{
+				"gateways": []interface{}{"istio-system/public"},
+			}),
+			newObject(utils.VirtualServiceGVK, "shop", "admin", map[string]interface{}{
+				"gateways": []interface{}{"istio-system/internal"},
+			}),
+		).Build()
+
+		// The Service of the default install selects more labels than its Gateway
+		service := &corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "istio-system", Name: "istio-ingressgateway"},
+			Spec: corev1.ServiceSpec{Type: corev1.ServiceTypeLoadBalancer,
+				Selector: map[string]string{"app": "istio-ingressgateway", "istio": "ingressgateway"}},
+		}
+		Expect(virtualServicesForService(context.Background(), c, service)).To(ConsistOf(
+			reconcile.Request{NamespacedName: types.NamespacedName{Namespace: "shop", Name: "web"}},
+		))
+
+		headless := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "db"},
+			Spec: corev1.ServiceSpec{ClusterIP: corev1.ClusterIPNone}}
+		Expect(virtualServicesForService(context.Background(), c, headless)).To(BeEmpty())
+	})
+
+	It("should watch the related kinds the scheme knows with their Go types", func() {
+		related, err := relatedObject(scheme.Scheme, corev1.SchemeGroupVersion.WithKind("Service"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(related).To(BeAssignableToTypeOf(&corev1.Service{}))
+
+		related, err = relatedObject(scheme.Scheme, utils.IstioGatewayGVK)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(related).To(BeAssignableToTypeOf(&unstructured.Unstructured{}))
+	})
+})
@@ -0,0 +1,100 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/wentidev/agent/internal/utils"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// maintenanceState merges the maintenance windows of the object and its namespace. Invalid
+// windows are ignored and reported as a Warning Event on the object, so that its check is
+// still synced.
+func maintenanceState(ctx context.Context, c client.Reader, recorder record.EventRecorder, obj client.Object) (utils.Maintenance, error) {
+	now := time.Now()
+
+	maintenance, err := utils.GetMaintenance(obj.GetAnnotations(), now)
+	if err != nil {
+		reportInvalidMaintenance(recorder, obj, err)
+	}
+
+	namespace := &corev1.Namespace{}
+	if err := c.Get(ctx, types.NamespacedName{Name: obj.GetNamespace()}, namespace); err != nil {
+		return maintenance, client.IgnoreNotFound(err)
+	}
+	namespaceMaintenance, err := utils.GetMaintenance(namespace.Annotations, now)
+	if err != nil {
+		reportInvalidMaintenance(recorder, obj, fmt.Errorf("namespace %s: %w", namespace.Name, err))
+	}
+
+	return maintenance.Merge(namespaceMaintenance), nil
+}
+
+// reportInvalidMaintenance surfaces a maintenance window the agent ignores
+func reportInvalidMaintenance(recorder record.EventRecorder, obj client.Object, err error) {
+	log.Log.Info("ignoring invalid maintenance window", "object", client.ObjectKeyFromObject(obj), "reason", err.Error())
+	if recorder != nil {
+		recorder.Eventf(obj, corev1.EventTypeWarning, "InvalidMaintenanceWindow", "%v, ignoring it", err)
+	}
+}
+
+// recordMaintenance emits an Event when the object enters or leaves a maintenance window,
+// states tracks whether each object was last seen in one
+func recordMaintenance(recorder record.EventRecorder, states *sync.Map, obj client.Object, maintenance utils.Maintenance) {
+	key := client.ObjectKeyFromObject(obj)
+	previous, known := states.Swap(key, maintenance.Active)
+	if (!known && !maintenance.Active) || (known && previous.(bool) == maintenance.Active) {
+		return
+	}
+	if recorder == nil {
+		return
+	}
+
+	if maintenance.Active {
+		recorder.Eventf(obj, corev1.EventTypeNormal, "MaintenanceStarted",
+			"Health check disabled until %s", maintenance.NextTransition.Format(time.RFC3339))
+		return
+	}
+	recorder.Event(obj, corev1.EventTypeNormal, "MaintenanceEnded", "Health check re-enabled")
+}
+
+// ingressesForNamespace maps a Namespace to all the Ingresses it contains
+func (r *IngressReconciler) ingressesForNamespace(ctx context.Context, obj client.Object) []reconcile.Request {
+	ingresses := &networkingv1.IngressList{}
+	if err := r.List(ctx, ingresses, client.InNamespace(obj.GetName())); err != nil {
+		return nil
+	}
+
+	requests := make([]reconcile.Request, 0, len(ingresses.Items))
+	for _, ingress := range ingresses.Items {
+		requests = append(requests, reconcile.Request{
+			NamespacedName: types.NamespacedName{Namespace: ingress.Namespace, Name: ingress.Name},
+		})
+	}
+	return requests
+}
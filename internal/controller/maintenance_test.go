@@ -0,0 +1,62 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/wentidev/agent/internal/utils"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+var _ = Describe("Maintenance windows", func() {
+	It("should ignore and report invalid windows", func() {
+		until := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+		namespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "shop",
+			Annotations: map[string]string{utils.MaintenanceUntil: until}}}
+		ingress := &networkingv1.Ingress{ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "shop",
+			Annotations: map[string]string{utils.MaintenanceWindow: "every night"}}}
+		recorder := record.NewFakeRecorder(10)
+
+		maintenance, err := maintenanceState(context.Background(), fake.NewClientBuilder().WithObjects(namespace).Build(),
+			recorder, ingress)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(maintenance.Active).To(BeTrue())
+		Expect(recorder.Events).To(Receive(ContainSubstring("InvalidMaintenanceWindow")))
+	})
+	It("should forget the state of deleted ingresses", func() {
+		fakeAPI()
+		key := types.NamespacedName{Namespace: "shop", Name: "web"}
+		r := &IngressReconciler{Client: fake.NewClientBuilder().Build()}
+		r.maintenance.Store(key, true)
+
+		_, err := r.Reconcile(context.Background(), reconcile.Request{NamespacedName: key})
+		Expect(err).NotTo(HaveOccurred())
+		_, known := r.maintenance.Load(key)
+		Expect(known).To(BeFalse())
+	})
+})
@@ -0,0 +1,140 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	monitoringv1alpha1 "github.com/wentidev/agent/api/v1alpha1"
+	"github.com/wentidev/agent/internal/metrics"
+	"github.com/wentidev/agent/internal/utils"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// namespacePolicy returns the policy merging the HealthCheckPolicies of the namespace and
+// the ClusterHealthCheckPolicies
+func namespacePolicy(ctx context.Context, c client.Reader, namespace string) (utils.Policy, error) {
+	policies := &monitoringv1alpha1.HealthCheckPolicyList{}
+	if err := c.List(ctx, policies, client.InNamespace(namespace)); err != nil {
+		return utils.Policy{}, err
+	}
+	clusterPolicies := &monitoringv1alpha1.ClusterHealthCheckPolicyList{}
+	if err := c.List(ctx, clusterPolicies); err != nil {
+		return utils.Policy{}, err
+	}
+
+	specs := make([]monitoringv1alpha1.HealthCheckPolicySpec, 0, len(policies.Items)+len(clusterPolicies.Items))
+	for _, policy := range policies.Items {
+		specs = append(specs, policy.Spec)
+	}
+	for _, policy := range clusterPolicies.Items {
+		specs = append(specs, policy.Spec)
+	}
+	return utils.MergePolicies(specs...), nil
+}
+
+// applyPolicy clamps the checks of a namespace to its policy and disables the ones it
+// rejects, recording the violations on each check for enforcePolicy to report
+func applyPolicy(ctx context.Context, c client.Reader, namespace string, checks []utils.IngressInfo) error {
+	if len(checks) == 0 {
+		return nil
+	}
+	policy, err := namespacePolicy(ctx, c, namespace)
+	if err != nil {
+		return err
+	}
+	for i := range checks {
+		checks[i].Violations = policy.Apply(&checks[i])
+	}
+	return nil
+}
+
+// enforcePolicy checks the checks of obj, clamped by applyPolicy, against the quota of its
+// namespace and reports their violations. It returns ErrPolicyViolation when they exceed the
+// quota, in which case they must be deleted. Callers hold LockNamespace until they are synced.
+func enforcePolicy(ctx context.Context, c client.Reader, recorder record.EventRecorder, obj client.Object,
+	owner string, checks []utils.IngressInfo) error {
+	var violations []utils.PolicyViolation
+	if len(checks) > 0 {
+		policy, err := namespacePolicy(ctx, c, obj.GetNamespace())
+		if err != nil {
+			return err
+		}
+		violations = policy.Quota(utils.Checks.CountInNamespace(obj.GetNamespace(), owner), len(checks))
+	}
+	for _, check := range checks {
+		violations = append(violations, check.Violations...)
+	}
+	reportViolations(recorder, obj, owner, violations)
+
+	for _, violation := range violations {
+		if violation.Rule == utils.PolicyMaxChecks {
+			return fmt.Errorf("%w: %s", utils.ErrPolicyViolation, violation.Message)
+		}
+	}
+	return nil
+}
+
+// violationStates holds the violations last reported for each owner
+var violationStates sync.Map
+
+// reportViolations records the violations of the checks of owner in the violation metric and,
+// when they changed since the last reconcile, reports each of them as a Warning Event
+func reportViolations(recorder record.EventRecorder, obj client.Object, owner string, violations []utils.PolicyViolation) {
+	counts := map[string]int{}
+	messages := make([]string, 0, len(violations))
+	for _, violation := range violations {
+		counts[violation.Rule]++
+		messages = append(messages, violation.Rule+": "+violation.Message)
+	}
+	metrics.SetPolicyViolations(owner, counts)
+
+	state := strings.Join(messages, "\n")
+	if previous, _ := violationStates.Swap(owner, state); previous == nil && state == "" || previous == state {
+		return
+	}
+	for _, violation := range violations {
+		log.Log.Info("health check breaks the policy", "owner", owner, "rule", violation.Rule,
+			"action", violation.Action(), "reason", violation.Message)
+		if recorder != nil {
+			recorder.Eventf(obj, corev1.EventTypeWarning, "PolicyViolation", "%s: %s", violation.Rule, violation.Message)
+		}
+	}
+}
+
+// forgetViolations stops reporting the violations of an owner which is gone or no longer monitored
+func forgetViolations(owner string) {
+	violationStates.Delete(owner)
+	metrics.ForgetPolicyViolations(owner)
+}
+
+// policyHandler enqueues the objects a policy applies to with the namespace mapper of a
+// reconciler: the objects of its namespace, or of every namespace for a cluster policy
+func policyHandler(forNamespace handler.MapFunc) handler.EventHandler {
+	return handler.EnqueueRequestsFromMapFunc(func(ctx context.Context, obj client.Object) []reconcile.Request {
+		return forNamespace(ctx, &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: obj.GetNamespace()}})
+	})
+}
@@ -0,0 +1,169 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/wentidev/agent/internal/utils"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// annotationPrefix is the prefix of the annotations read by the agent
+const annotationPrefix = "wenti.dev/"
+
+// wentiAnnotations returns the wenti.dev/ annotations of an object, except the ones the agent writes
+func wentiAnnotations(annotations map[string]string) map[string]string {
+	result := map[string]string{}
+	for key, value := range annotations {
+		if strings.HasPrefix(key, annotationPrefix) && key != utils.HealthCheckStatus {
+			result[key] = value
+		}
+	}
+	return result
+}
+
+// wentiAnnotationChangedPredicate passes updates changing a wenti.dev/ annotation
+func wentiAnnotationChangedPredicate() predicate.Predicate {
+	return predicate.Funcs{
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			if e.ObjectOld == nil || e.ObjectNew == nil {
+				return false
+			}
+			oldAnnotations := wentiAnnotations(e.ObjectOld.GetAnnotations())
+			newAnnotations := wentiAnnotations(e.ObjectNew.GetAnnotations())
+			if len(oldAnnotations) != len(newAnnotations) {
+				return true
+			}
+			for key, value := range newAnnotations {
+				if old, ok := oldAnnotations[key]; !ok || old != value {
+					return true
+				}
+			}
+			return false
+		},
+	}
+}
+
+// fieldChangedPredicate passes updates changing a top-level field of objects, unstructured or typed
+func fieldChangedPredicate(field string) predicate.Predicate {
+	return predicate.Funcs{
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			oldField, ok := topLevelField(e.ObjectOld, field)
+			if !ok {
+				return false
+			}
+			newField, ok := topLevelField(e.ObjectNew, field)
+			if !ok {
+				return false
+			}
+			return !equality.Semantic.DeepEqual(oldField, newField)
+		},
+	}
+}
+
+// topLevelField returns a top-level field of an object, converting typed objects
+func topLevelField(obj client.Object, field string) (interface{}, bool) {
+	if obj == nil {
+		return nil, false
+	}
+	if u, ok := obj.(*unstructured.Unstructured); ok {
+		return u.Object[field], true
+	}
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return nil, false
+	}
+	return content[field], true
+}
+
+// statusChangedPredicate passes updates changing the status of unstructured objects, which
+// some sources read their hosts from, such as the ingress host of OpenShift Routes
+func statusChangedPredicate() predicate.Predicate {
+	return fieldChangedPredicate("status")
+}
+
+// sourcePredicates passes the updates of source objects which may change their checks,
+// including the status updates some sources read their hosts from
+func sourcePredicates() predicate.Predicate {
+	return predicate.Or(
+		predicate.GenerationChangedPredicate{},
+		predicate.AnnotationChangedPredicate{},
+		statusChangedPredicate(),
+	)
+}
+
+// ingressPredicates filters out the Ingress updates which cannot change the health check,
+// such as load-balancer status updates. Creations and deletions always pass.
+func ingressPredicates() predicate.Predicate {
+	return predicate.Or(
+		predicate.GenerationChangedPredicate{},
+		predicate.LabelChangedPredicate{},
+		wentiAnnotationChangedPredicate(),
+	)
+}
+
+// debouncedHandler enqueues Ingress updates after the debounce delay, so that a burst
+// of updates on the same Ingress results in a single reconcile
+func (r *IngressReconciler) debouncedHandler() handler.EventHandler {
+	enqueue := &handler.EnqueueRequestForObject{}
+	return handler.Funcs{
+		CreateFunc:  enqueue.Create,
+		DeleteFunc:  enqueue.Delete,
+		GenericFunc: enqueue.Generic,
+		UpdateFunc: func(ctx context.Context, e event.UpdateEvent, q workqueue.TypedRateLimitingInterface[reconcile.Request]) {
+			if e.ObjectNew == nil {
+				return
+			}
+			req := reconcile.Request{NamespacedName: types.NamespacedName{
+				Namespace: e.ObjectNew.GetNamespace(),
+				Name:      e.ObjectNew.GetName(),
+			}}
+			if r.Debounce <= 0 {
+				q.Add(req)
+				return
+			}
+			r.lastUpdate.Store(req.NamespacedName, time.Now())
+			q.AddAfter(req, r.Debounce)
+		},
+	}
+}
+
+// debounceRemaining returns how long to wait before reconciling the key, zero once
+// no update was received during the debounce delay
+func (r *IngressReconciler) debounceRemaining(key types.NamespacedName) time.Duration {
+	value, ok := r.lastUpdate.Load(key)
+	if !ok {
+		return 0
+	}
+	if remaining := r.Debounce - time.Since(value.(time.Time)); remaining > 0 {
+		return remaining
+	}
+	r.lastUpdate.CompareAndDelete(key, value)
+	return 0
+}
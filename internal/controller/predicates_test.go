@@ -0,0 +1,108 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/wentidev/agent/internal/utils"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+)
+
+var _ = Describe("Ingress predicates", func() {
+	newIngress := func() *networkingv1.Ingress {
+		return &networkingv1.Ingress{ObjectMeta: metav1.ObjectMeta{
+			Name: "web", Namespace: "shop", Generation: 1,
+			Labels:      map[string]string{"app": "web"},
+			Annotations: map[string]string{utils.HealthCheckMethod: "GET"},
+		}}
+	}
+	updated := func(change func(*networkingv1.Ingress)) bool {
+		old := newIngress()
+		ingress := old.DeepCopy()
+		change(ingress)
+		return ingressPredicates().Update(event.UpdateEvent{ObjectOld: old, ObjectNew: ingress})
+	}
+
+	It("should pass the changes of the spec, the labels and the wenti.dev annotations", func() {
+		Expect(updated(func(i *networkingv1.Ingress) { i.Generation++ })).To(BeTrue())
+		Expect(updated(func(i *networkingv1.Ingress) { i.Labels["app"] = "api" })).To(BeTrue())
+		Expect(updated(func(i *networkingv1.Ingress) { i.Annotations[utils.HealthCheckMethod] = "HEAD" })).To(BeTrue())
+		Expect(updated(func(i *networkingv1.Ingress) { i.Annotations[utils.HealthCheckPath] = "/healthz" })).To(BeTrue())
+		Expect(updated(func(i *networkingv1.Ingress) { delete(i.Annotations, utils.HealthCheckMethod) })).To(BeTrue())
+	})
+
+	It("should filter out status updates and the annotations of other tools", func() {
+		Expect(updated(func(i *networkingv1.Ingress) {
+			i.Status.LoadBalancer.Ingress = []networkingv1.IngressLoadBalancerIngress{{IP: "10.0.0.1"}}
+		})).To(BeFalse())
+		Expect(updated(func(i *networkingv1.Ingress) { i.Annotations["kubectl.kubernetes.io/restartedAt"] = "now" })).To(BeFalse())
+	})
+
+	It("should ignore the status annotation written by the agent", func() {
+		Expect(updated(func(i *networkingv1.Ingress) { i.Annotations[utils.HealthCheckStatus] = "DOWN" })).To(BeFalse())
+	})
+
+	It("should always pass creations and deletions", func() {
+		Expect(ingressPredicates().Create(event.CreateEvent{Object: newIngress()})).To(BeTrue())
+		Expect(ingressPredicates().Delete(event.DeleteEvent{Object: newIngress()})).To(BeTrue())
+	})
+
+	It("should compare the wenti.dev annotations of any kind of object", func() {
+		service := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: "web", Annotations: map[string]string{}}}
+		changed := service.DeepCopy()
+		changed.Annotations[utils.HealthCheckPath] = "/healthz"
+		Expect(wentiAnnotationChangedPredicate().Update(event.UpdateEvent{ObjectOld: service, ObjectNew: changed})).To(BeTrue())
+	})
+
+	It("should compare the fields of typed objects", func() {
+		service := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: "lb"}, Spec: corev1.ServiceSpec{Type: corev1.ServiceTypeClusterIP}}
+		changed := service.DeepCopy()
+		changed.Spec.Type = corev1.ServiceTypeLoadBalancer
+		Expect(fieldChangedPredicate("spec").Update(event.UpdateEvent{ObjectOld: service, ObjectNew: changed})).To(BeTrue())
+		changed = service.DeepCopy()
+		changed.Status.LoadBalancer.Ingress = []corev1.LoadBalancerIngress{{IP: "192.0.2.1"}}
+		Expect(fieldChangedPredicate("spec").Update(event.UpdateEvent{ObjectOld: service, ObjectNew: changed})).To(BeFalse())
+	})
+})
+
+var _ = Describe("Debounce", func() {
+	key := types.NamespacedName{Namespace: "shop", Name: "web"}
+
+	It("should wait for the end of the debounce delay", func() {
+		r := &IngressReconciler{Debounce: time.Minute}
+		Expect(r.debounceRemaining(key)).To(BeZero())
+
+		r.lastUpdate.Store(key, time.Now())
+		Expect(r.debounceRemaining(key)).To(BeNumerically(">", 59*time.Second))
+	})
+
+	It("should forget the update once the delay elapsed", func() {
+		r := &IngressReconciler{Debounce: time.Minute}
+		r.lastUpdate.Store(key, time.Now().Add(-2*time.Minute))
+		Expect(r.debounceRemaining(key)).To(BeZero())
+		_, found := r.lastUpdate.Load(key)
+		Expect(found).To(BeFalse())
+	})
+})
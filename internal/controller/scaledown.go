@@ -0,0 +1,258 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	"github.com/wentidev/agent/internal/utils"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// backendServiceIndex indexes Ingresses by the names of their backend Services
+const backendServiceIndex = ".spec.backend.service.name"
+
+// backendServices returns the names of all Services referenced by the ingress
+func backendServices(ingress *networkingv1.Ingress) []string {
+	seen := map[string]bool{}
+	var services []string
+	add := func(backend *networkingv1.IngressBackend) {
+		if backend == nil || backend.Service == nil || seen[backend.Service.Name] {
+			return
+		}
+		seen[backend.Service.Name] = true
+		services = append(services, backend.Service.Name)
+	}
+
+	add(ingress.Spec.DefaultBackend)
+	for _, rule := range ingress.Spec.Rules {
+		if rule.HTTP == nil {
+			continue
+		}
+		for i := range rule.HTTP.Paths {
+			add(&rule.HTTP.Paths[i].Backend)
+		}
+	}
+	return services
+}
+
+// indexBackendServices is the IndexerFunc for backendServiceIndex
+func indexBackendServices(obj client.Object) []string {
+	ingress, ok := obj.(*networkingv1.Ingress)
+	if !ok {
+		return nil
+	}
+	return backendServices(ingress)
+}
+
+// ingressesForEndpointSlice maps an EndpointSlice to the Ingresses using its Service as a backend
+func (r *IngressReconciler) ingressesForEndpointSlice(ctx context.Context, obj client.Object) []reconcile.Request {
+	serviceName := obj.GetLabels()[discoveryv1.LabelServiceName]
+	if serviceName == "" {
+		return nil
+	}
+	return r.ingressesForService(ctx, obj.GetNamespace(), serviceName)
+}
+
+// ingressesForWorkload maps a Deployment or StatefulSet to the Ingresses using a Service
+// which selects its pods as a backend
+func (r *IngressReconciler) ingressesForWorkload(ctx context.Context, obj client.Object) []reconcile.Request {
+	var requests []reconcile.Request
+	for _, service := range servicesForWorkload(ctx, r.Client, obj) {
+		requests = append(requests, r.ingressesForService(ctx, service.Namespace, service.Name)...)
+	}
+	return requests
+}
+
+// ingressesForService returns the requests of the Ingresses using the Service as a backend
+func (r *IngressReconciler) ingressesForService(ctx context.Context, namespace, service string) []reconcile.Request {
+	ingresses := &networkingv1.IngressList{}
+	if err := r.List(ctx, ingresses,
+		client.InNamespace(namespace),
+		client.MatchingFields{backendServiceIndex: service},
+	); err != nil {
+		return nil
+	}
+
+	requests := make([]reconcile.Request, 0, len(ingresses.Items))
+	for _, ingress := range ingresses.Items {
+		requests = append(requests, reconcile.Request{
+			NamespacedName: types.NamespacedName{Namespace: ingress.Namespace, Name: ingress.Name},
+		})
+	}
+	return requests
+}
+
+// isScaledDown reports whether every backend of the ingress has been intentionally scaled to zero
+func (r *IngressReconciler) isScaledDown(ctx context.Context, ingress *networkingv1.Ingress) (bool, error) {
+	services := backendServices(ingress)
+	if len(services) == 0 {
+		return false, nil
+	}
+
+	for _, name := range services {
+		intentional, err := serviceScaledDown(ctx, r.Client, ingress.Namespace, name)
+		if err != nil || !intentional {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// serviceScaledDown reports whether the Service has no ready endpoint because a workload
+// it selects has been intentionally scaled to zero
+func serviceScaledDown(ctx context.Context, c client.Reader, namespace, name string) (bool, error) {
+	ready, err := readyEndpoints(ctx, c, namespace, name)
+	if err != nil || ready > 0 {
+		return false, err
+	}
+	return workloadScaledDown(ctx, c, namespace, name)
+}
+
+// readyEndpoints counts the ready endpoints across all EndpointSlices of a Service
+func readyEndpoints(ctx context.Context, c client.Reader, namespace, service string) (int, error) {
+	slices := &discoveryv1.EndpointSliceList{}
+	if err := c.List(ctx, slices,
+		client.InNamespace(namespace),
+		client.MatchingLabels{discoveryv1.LabelServiceName: service},
+	); err != nil {
+		return 0, err
+	}
+
+	ready := 0
+	for _, slice := range slices.Items {
+		for _, endpoint := range slice.Endpoints {
+			// A nil Ready condition must be interpreted as ready
+			if endpoint.Conditions.Ready == nil || *endpoint.Conditions.Ready {
+				ready++
+			}
+		}
+	}
+	return ready, nil
+}
+
+// workloadScaledDown reports whether a workload selected by the Service has zero replicas
+// or carries the scaled-down marker
+func workloadScaledDown(ctx context.Context, c client.Reader, namespace, service string) (bool, error) {
+	svc := &corev1.Service{}
+	if err := c.Get(ctx, types.NamespacedName{Namespace: namespace, Name: service}, svc); err != nil {
+		return false, client.IgnoreNotFound(err)
+	}
+	if len(svc.Spec.Selector) == 0 {
+		return false, nil
+	}
+	selector := labels.SelectorFromSet(svc.Spec.Selector)
+
+	deployments := &appsv1.DeploymentList{}
+	if err := c.List(ctx, deployments, client.InNamespace(namespace)); err != nil {
+		return false, err
+	}
+	for _, deployment := range deployments.Items {
+		if !selector.Matches(labels.Set(deployment.Spec.Template.Labels)) {
+			continue
+		}
+		if scaledDown(&deployment, deployment.Spec.Replicas) {
+			return true, nil
+		}
+	}
+
+	statefulSets := &appsv1.StatefulSetList{}
+	if err := c.List(ctx, statefulSets, client.InNamespace(namespace)); err != nil {
+		return false, err
+	}
+	for _, statefulSet := range statefulSets.Items {
+		if !selector.Matches(labels.Set(statefulSet.Spec.Template.Labels)) {
+			continue
+		}
+		if scaledDown(&statefulSet, statefulSet.Spec.Replicas) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// servicesForWorkload returns the Services selecting the pods of a Deployment or StatefulSet
+func servicesForWorkload(ctx context.Context, c client.Reader, obj client.Object) []corev1.Service {
+	podLabels, _, ok := workloadPods(obj)
+	if !ok {
+		return nil
+	}
+	services := &corev1.ServiceList{}
+	if err := c.List(ctx, services, client.InNamespace(obj.GetNamespace())); err != nil {
+		return nil
+	}
+
+	var selecting []corev1.Service
+	for _, service := range services.Items {
+		if len(service.Spec.Selector) > 0 &&
+			labels.SelectorFromSet(service.Spec.Selector).Matches(labels.Set(podLabels)) {
+			selecting = append(selecting, service)
+		}
+	}
+	return selecting
+}
+
+// workloadPods returns the pod template labels and desired replicas of a Deployment or StatefulSet
+func workloadPods(obj client.Object) (map[string]string, *int32, bool) {
+	switch workload := obj.(type) {
+	case *appsv1.Deployment:
+		return workload.Spec.Template.Labels, workload.Spec.Replicas, true
+	case *appsv1.StatefulSet:
+		return workload.Spec.Template.Labels, workload.Spec.Replicas, true
+	}
+	return nil, nil, false
+}
+
+// workloadScaledDownPredicate passes the Deployments and StatefulSets being scaled down or
+// back up, or gaining or losing the scaled-down marker, and the deletions of scaled down ones
+func workloadScaledDownPredicate() predicate.Predicate {
+	isScaledDown := func(obj client.Object) bool {
+		_, replicas, ok := workloadPods(obj)
+		return ok && scaledDown(obj, replicas)
+	}
+	return predicate.Funcs{
+		CreateFunc: func(e event.CreateEvent) bool {
+			return isScaledDown(e.Object)
+		},
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			return isScaledDown(e.ObjectOld) != isScaledDown(e.ObjectNew)
+		},
+		DeleteFunc: func(e event.DeleteEvent) bool {
+			return isScaledDown(e.Object)
+		},
+		GenericFunc: func(e event.GenericEvent) bool {
+			return false
+		},
+	}
+}
+
+// scaledDown reports whether a workload has zero desired replicas or the scaled-down marker
+func scaledDown(obj client.Object, replicas *int32) bool {
+	if replicas != nil && *replicas == 0 {
+		return true
+	}
+	return obj.GetAnnotations()[utils.ScaledDown] == "true" || obj.GetLabels()[utils.ScaledDown] == "true"
+}
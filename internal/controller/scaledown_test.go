@@ -0,0 +1,154 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/wentidev/agent/internal/utils"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+var _ = Describe("Scale down detection", func() {
+	const namespace = "shop"
+	selector := map[string]string{"app": "web"}
+	pathType := networkingv1.PathTypePrefix
+
+	newIngress := func(name string, services ...string) *networkingv1.Ingress {
+		paths := make([]networkingv1.HTTPIngressPath, 0, len(services))
+		for _, service := range services {
+			paths = append(paths, networkingv1.HTTPIngressPath{
+				Path:     "/",
+				PathType: &pathType,
+				Backend: networkingv1.IngressBackend{
+					Service: &networkingv1.IngressServiceBackend{Name: service, Port: networkingv1.ServiceBackendPort{Number: 80}},
+				},
+			})
+		}
+		return &networkingv1.Ingress{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+			Spec: networkingv1.IngressSpec{Rules: []networkingv1.IngressRule{{
+				Host:             name + ".example.com",
+				IngressRuleValue: networkingv1.IngressRuleValue{HTTP: &networkingv1.HTTPIngressRuleValue{Paths: paths}},
+			}}},
+		}
+	}
+	newService := func(name string) *corev1.Service {
+		return &corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+			Spec:       corev1.ServiceSpec{Selector: selector},
+		}
+	}
+	newDeployment := func(replicas int32, annotations map[string]string) *appsv1.Deployment {
+		return &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: namespace, Annotations: annotations},
+			Spec: appsv1.DeploymentSpec{
+				Replicas: &replicas,
+				Template: corev1.PodTemplateSpec{ObjectMeta: metav1.ObjectMeta{Labels: selector}},
+			},
+		}
+	}
+	newSlice := func(service string, ready bool) *discoveryv1.EndpointSlice {
+		return &discoveryv1.EndpointSlice{
+			ObjectMeta: metav1.ObjectMeta{Name: service + "-abc", Namespace: namespace,
+				Labels: map[string]string{discoveryv1.LabelServiceName: service}},
+			AddressType: discoveryv1.AddressTypeIPv4,
+			Endpoints: []discoveryv1.Endpoint{{
+				Addresses:  []string{"10.0.0.1"},
+				Conditions: discoveryv1.EndpointConditions{Ready: &ready},
+			}},
+		}
+	}
+	newReconciler := func(objs ...client.Object) *IngressReconciler {
+		c := fake.NewClientBuilder().WithObjects(objs...).
+			WithIndex(&networkingv1.Ingress{}, backendServiceIndex, indexBackendServices).
+			Build()
+		return &IngressReconciler{Client: c}
+	}
+
+	It("should detect workloads scaled to zero", func() {
+		ingress := newIngress("web", "web")
+		r := newReconciler(ingress, newService("web"), newDeployment(0, nil))
+		Expect(r.isScaledDown(context.Background(), ingress)).To(BeTrue())
+	})
+
+	It("should detect workloads carrying the scaled-down marker", func() {
+		c := fake.NewClientBuilder().
+			WithObjects(newService("web"), newDeployment(2, map[string]string{utils.ScaledDown: "true"})).
+			Build()
+		Expect(workloadScaledDown(context.Background(), c, namespace, "web")).To(BeTrue())
+	})
+
+	It("should not consider outages as scale downs", func() {
+		ingress := newIngress("web", "web")
+		r := newReconciler(ingress, newService("web"), newDeployment(3, nil), newSlice("web", false))
+		Expect(r.isScaledDown(context.Background(), ingress)).To(BeFalse())
+	})
+
+	It("should require every backend to be scaled down", func() {
+		ingress := newIngress("web", "web", "api")
+		api := newService("api")
+		api.Spec.Selector = map[string]string{"app": "api"}
+		r := newReconciler(ingress, newService("web"), api, newDeployment(0, nil), newSlice("api", true))
+		Expect(r.isScaledDown(context.Background(), ingress)).To(BeFalse())
+	})
+
+	It("should not consider ingresses without a backend as scaled down", func() {
+		ingress := newIngress("web")
+		Expect(newReconciler(ingress).isScaledDown(context.Background(), ingress)).To(BeFalse())
+	})
+
+	It("should map EndpointSlices to the Ingresses using their Service", func() {
+		r := newReconciler(newIngress("web", "web"), newIngress("both", "web", "api"), newIngress("api", "api"))
+		Expect(r.ingressesForEndpointSlice(context.Background(), newSlice("web", true))).To(ConsistOf(
+			reconcile.Request{NamespacedName: types.NamespacedName{Namespace: namespace, Name: "web"}},
+			reconcile.Request{NamespacedName: types.NamespacedName{Namespace: namespace, Name: "both"}},
+		))
+		Expect(r.ingressesForEndpointSlice(context.Background(), &discoveryv1.EndpointSlice{})).To(BeEmpty())
+	})
+	It("should map scaled down workloads to the Ingresses using a Service selecting them", func() {
+		api := newService("api")
+		api.Spec.Selector = map[string]string{"app": "api"}
+		r := newReconciler(newIngress("web", "web"), newIngress("api", "api"), newService("web"), api)
+		Expect(r.ingressesForWorkload(context.Background(), newDeployment(0, nil))).To(ConsistOf(
+			reconcile.Request{NamespacedName: types.NamespacedName{Namespace: namespace, Name: "web"}},
+		))
+		Expect(r.ingressesForWorkload(context.Background(), newIngress("web"))).To(BeEmpty())
+	})
+
+	It("should only pass workloads changing their scaled-down state", func() {
+		running, marked := newDeployment(2, nil), newDeployment(2, map[string]string{utils.ScaledDown: "true"})
+		Expect(workloadScaledDownPredicate().Update(event.UpdateEvent{ObjectOld: running, ObjectNew: marked})).To(BeTrue())
+		Expect(workloadScaledDownPredicate().Update(event.UpdateEvent{ObjectOld: marked, ObjectNew: running})).To(BeTrue())
+		Expect(workloadScaledDownPredicate().Update(event.UpdateEvent{ObjectOld: running, ObjectNew: newDeployment(0, nil)})).To(BeTrue())
+		Expect(workloadScaledDownPredicate().Update(event.UpdateEvent{ObjectOld: running, ObjectNew: newDeployment(3, nil)})).To(BeFalse())
+		Expect(workloadScaledDownPredicate().Delete(event.DeleteEvent{Object: marked})).To(BeTrue())
+		Expect(workloadScaledDownPredicate().Create(event.CreateEvent{Object: running})).To(BeFalse())
+	})
+})
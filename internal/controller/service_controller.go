@@ -0,0 +1,222 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	monitoringv1alpha1 "github.com/wentidev/agent/api/v1alpha1"
+	"github.com/wentidev/agent/internal/metrics"
+	"github.com/wentidev/agent/internal/tracing"
+	"github.com/wentidev/agent/internal/utils"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// ServiceReconciler monitors the Services of type LoadBalancer which opt in with the
+// wenti.dev/monitor annotation, with one check per port
+type ServiceReconciler struct {
+	client.Client
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
+
+	// MaxConcurrentReconciles is the number of Services reconciled in parallel
+	MaxConcurrentReconciles int
+
+	// maintenance tracks whether each service was last seen in a maintenance window
+	maintenance sync.Map
+}
+
+// +kubebuilder:rbac:groups=core,resources=services,verbs=get;list;watch
+
+func (r *ServiceReconciler) Reconcile(ctx context.Context, req ctrl.Request) (result ctrl.Result, err error) {
+	ctx, span := tracing.Tracer().Start(ctx, "Reconcile Service", trace.WithAttributes(
+		attribute.String("k8s.namespace.name", req.Namespace),
+		attribute.String("k8s.service.name", req.Name),
+	))
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, "reconcile failed")
+		}
+		span.End()
+		metrics.ObserveReconcile(req.Namespace, err)
+	}()
+
+	owner := utils.OwnerKey("Service", req.Namespace, req.Name)
+	service := &corev1.Service{}
+	err = r.Get(ctx, req.NamespacedName, service)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return ctrl.Result{}, err
+	}
+	if err != nil || !utils.MonitorEnabled(service.Annotations) || service.Spec.Type != corev1.ServiceTypeLoadBalancer {
+		// Deleted, opted out or no longer exposed: drop its checks
+		r.maintenance.Delete(req.NamespacedName)
+		return ctrl.Result{}, dropChecks(ctx, owner)
+	}
+
+	checks, maintenance, err := r.DesiredChecks(ctx, service)
+	if errors.Is(err, utils.ErrNoHost) {
+		log.Log.Info("load balancer has no address, dropping its checks", "service", req.NamespacedName)
+		return ctrl.Result{}, dropChecks(ctx, owner)
+	}
+	if err != nil {
+		return ctrl.Result{}, reportInvalidCheck(r.Recorder, service, err)
+	}
+
+	if _, err := reconcileChecks(ctx, r.Client, r.Recorder, service, owner, checks); err != nil {
+		return ctrl.Result{}, err
+	}
+	recordMaintenance(r.Recorder, &r.maintenance, service, maintenance)
+
+	if !maintenance.NextTransition.IsZero() {
+		result.RequeueAfter = time.Until(maintenance.NextTransition)
+	}
+	return result, nil
+}
+
+// DesiredChecks builds the checks of the service, clamped to the policies of its namespace and
+// disabled while its workload is scaled down or during maintenance windows of the service or
+// its namespace
+func (r *ServiceReconciler) DesiredChecks(ctx context.Context, service *corev1.Service) ([]utils.IngressInfo, utils.Maintenance, error) {
+	checks, err := utils.ServiceChecks(service)
+	if err != nil {
+		return nil, utils.Maintenance{}, err
+	}
+
+	scaledDown, err := serviceScaledDown(ctx, r.Client, service.Namespace, service.Name)
+	if err != nil {
+		log.Log.Error(err, "unable to determine service endpoints")
+		return nil, utils.Maintenance{}, err
+	}
+	maintenance, err := maintenanceState(ctx, r.Client, r.Recorder, service)
+	if err != nil {
+		log.Log.Error(err, "unable to determine maintenance window")
+		return nil, utils.Maintenance{}, err
+	}
+	for i := range checks {
+		if scaledDown || maintenance.Active {
+			checks[i].Enabled = false
+		}
+	}
+	if err := applyPolicy(ctx, r.Client, service.Namespace, checks); err != nil {
+		return nil, utils.Maintenance{}, err
+	}
+	return checks, maintenance, nil
+}
+
+// monitoredServicePredicate passes the events of Services which opt in to monitoring, or
+// did before an update
+func monitoredServicePredicate() predicate.Predicate {
+	return predicate.Funcs{
+		CreateFunc: func(e event.CreateEvent) bool {
+			return utils.MonitorEnabled(e.Object.GetAnnotations())
+		},
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			return utils.MonitorEnabled(e.ObjectOld.GetAnnotations()) || utils.MonitorEnabled(e.ObjectNew.GetAnnotations())
+		},
+		DeleteFunc: func(e event.DeleteEvent) bool {
+			return utils.MonitorEnabled(e.Object.GetAnnotations())
+		},
+		GenericFunc: func(e event.GenericEvent) bool {
+			return utils.MonitorEnabled(e.Object.GetAnnotations())
+		},
+	}
+}
+
+// serviceForEndpointSlice maps an EndpointSlice to its Service, if monitored
+func (r *ServiceReconciler) serviceForEndpointSlice(ctx context.Context, obj client.Object) []reconcile.Request {
+	serviceName := obj.GetLabels()[discoveryv1.LabelServiceName]
+	if serviceName == "" {
+		return nil
+	}
+	key := types.NamespacedName{Namespace: obj.GetNamespace(), Name: serviceName}
+	service := &corev1.Service{}
+	if err := r.Get(ctx, key, service); err != nil || !utils.MonitorEnabled(service.Annotations) {
+		return nil
+	}
+	return []reconcile.Request{{NamespacedName: key}}
+}
+
+// servicesForWorkload maps a Deployment or StatefulSet to the monitored Services selecting its pods
+func (r *ServiceReconciler) servicesForWorkload(ctx context.Context, obj client.Object) []reconcile.Request {
+	var requests []reconcile.Request
+	for _, service := range servicesForWorkload(ctx, r.Client, obj) {
+		if utils.MonitorEnabled(service.Annotations) {
+			requests = append(requests, reconcile.Request{
+				NamespacedName: types.NamespacedName{Namespace: service.Namespace, Name: service.Name},
+			})
+		}
+	}
+	return requests
+}
+
+// servicesForNamespace maps a Namespace to the monitored Services it contains
+func (r *ServiceReconciler) servicesForNamespace(ctx context.Context, obj client.Object) []reconcile.Request {
+	services := &corev1.ServiceList{}
+	if err := r.List(ctx, services, client.InNamespace(obj.GetName())); err != nil {
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for _, service := range services.Items {
+		if utils.MonitorEnabled(service.Annotations) {
+			requests = append(requests, reconcile.Request{
+				NamespacedName: types.NamespacedName{Namespace: service.Namespace, Name: service.Name},
+			})
+		}
+	}
+	return requests
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *ServiceReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&corev1.Service{}, builder.WithPredicates(monitoredServicePredicate())).
+		Watches(&discoveryv1.EndpointSlice{}, handler.EnqueueRequestsFromMapFunc(r.serviceForEndpointSlice)).
+		Watches(&appsv1.Deployment{}, handler.EnqueueRequestsFromMapFunc(r.servicesForWorkload),
+			builder.WithPredicates(workloadScaledDownPredicate())).
+		Watches(&appsv1.StatefulSet{}, handler.EnqueueRequestsFromMapFunc(r.servicesForWorkload),
+			builder.WithPredicates(workloadScaledDownPredicate())).
+		Watches(&corev1.Namespace{}, handler.EnqueueRequestsFromMapFunc(r.servicesForNamespace),
+			builder.WithPredicates(predicate.AnnotationChangedPredicate{})).
+		Watches(&monitoringv1alpha1.HealthCheckPolicy{}, policyHandler(r.servicesForNamespace)).
+		Watches(&monitoringv1alpha1.ClusterHealthCheckPolicy{}, policyHandler(r.servicesForNamespace)).
+		Named("service").
+		WithOptions(controller.Options{MaxConcurrentReconciles: r.MaxConcurrentReconciles}).
+		Complete(r)
+}
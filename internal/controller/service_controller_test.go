@@ -0,0 +1,200 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	monitoringv1alpha1 "github.com/wentidev/agent/api/v1alpha1"
+	"github.com/wentidev/agent/internal/metrics"
+	"github.com/wentidev/agent/internal/utils"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+var _ = Describe("Service controller", func() {
+	key := types.NamespacedName{Namespace: "shop", Name: "lb"}
+	ready := true
+
+	newService := func(monitor bool, serviceType corev1.ServiceType) *corev1.Service {
+		service := &corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: key.Name, Namespace: key.Namespace, Annotations: map[string]string{}},
+			Spec: corev1.ServiceSpec{
+				Type:  serviceType,
+				Ports: []corev1.ServicePort{{Name: "http", Port: 80}, {Name: "https", Port: 443}},
+			},
+			Status: corev1.ServiceStatus{LoadBalancer: corev1.LoadBalancerStatus{
+				Ingress: []corev1.LoadBalancerIngress{{Hostname: "lb.example.com"}},
+			}},
+		}
+		if monitor {
+			service.Annotations[utils.Monitor] = "true"
+		}
+		return service
+	}
+	newSlice := func(service string) *discoveryv1.EndpointSlice {
+		return &discoveryv1.EndpointSlice{
+			ObjectMeta: metav1.ObjectMeta{Name: service + "-abc", Namespace: key.Namespace,
+				Labels: map[string]string{discoveryv1.LabelServiceName: service}},
+			AddressType: discoveryv1.AddressTypeIPv4,
+			Endpoints: []discoveryv1.Endpoint{{
+				Addresses:  []string{"10.0.0.1"},
+				Conditions: discoveryv1.EndpointConditions{Ready: &ready},
+			}},
+		}
+	}
+	newReconciler := func(objs ...client.Object) *ServiceReconciler {
+		return &ServiceReconciler{Client: fake.NewClientBuilder().WithObjects(objs...).Build()}
+	}
+	reconcileService := func(r *ServiceReconciler) {
+		_, err := r.Reconcile(context.Background(), reconcile.Request{NamespacedName: key})
+		Expect(err).NotTo(HaveOccurred())
+	}
+	owner := utils.OwnerKey("Service", key.Namespace, key.Name)
+
+	It("should only watch the Services which opt in or opted out", func() {
+		monitored, plain := newService(true, corev1.ServiceTypeLoadBalancer), newService(false, corev1.ServiceTypeLoadBalancer)
+		Expect(monitoredServicePredicate().Create(event.CreateEvent{Object: monitored})).To(BeTrue())
+		Expect(monitoredServicePredicate().Create(event.CreateEvent{Object: plain})).To(BeFalse())
+		Expect(monitoredServicePredicate().Update(event.UpdateEvent{ObjectOld: monitored, ObjectNew: plain})).To(BeTrue())
+		Expect(monitoredServicePredicate().Update(event.UpdateEvent{ObjectOld: plain, ObjectNew: plain})).To(BeFalse())
+	})
+
+	It("should create one check per port of monitored LoadBalancer Services", func() {
+		calls := fakeAPI()
+		DeferCleanup(metrics.ForgetManagedCheck, owner)
+		reconcileService(newReconciler(newService(true, corev1.ServiceTypeLoadBalancer), newSlice(key.Name)))
+
+		Expect(calls.get()).To(ConsistOf("POST /api/v1/healthchecks", "POST /api/v1/healthchecks", "GET /api/v1/healthchecks"))
+		Expect(utils.Checks.ByOwner(owner)).To(HaveLen(2))
+		Expect(testutil.ToFloat64(metrics.ManagedChecks.WithLabelValues("enabled"))).To(BeNumerically(">=", 2))
+	})
+
+	It("should drop the checks of Services which are not LoadBalancers or did not opt in", func() {
+		for _, service := range []*corev1.Service{
+			newService(true, corev1.ServiceTypeClusterIP),
+			newService(false, corev1.ServiceTypeLoadBalancer),
+		} {
+			calls := fakeAPI()
+			reconcileService(newReconciler(service, newSlice(key.Name)))
+			Expect(calls.get()).To(ConsistOf("GET /api/v1/healthchecks"))
+		}
+	})
+
+	It("should drop the checks of Services which lost their load balancer address", func() {
+		calls := fakeAPI()
+		Expect(utils.Checks.EnsureSynced(context.Background())).To(Succeed())
+		utils.Checks.Put(utils.RemoteCheck{ID: "80", Labels: map[string]string{
+			utils.ManagedByLabel: utils.ManagedByValue, utils.ClusterLabel: utils.ClusterName,
+			utils.OwnerLabel: owner, utils.CheckKeyLabel: "80",
+		}})
+		service := newService(true, corev1.ServiceTypeLoadBalancer)
+		service.Status.LoadBalancer.Ingress = nil
+
+		reconcileService(newReconciler(service, newSlice(key.Name)))
+		Expect(calls.get()).To(ConsistOf("GET /api/v1/healthchecks", "DELETE /api/v1/healthchecks/80"))
+		Expect(utils.Checks.ByOwner(owner)).To(BeEmpty())
+	})
+
+	It("should map EndpointSlices to their monitored Service", func() {
+		r := newReconciler(newService(true, corev1.ServiceTypeLoadBalancer))
+		Expect(r.serviceForEndpointSlice(context.Background(), newSlice(key.Name))).To(ConsistOf(
+			reconcile.Request{NamespacedName: key},
+		))
+		Expect(r.serviceForEndpointSlice(context.Background(), newSlice("other"))).To(BeEmpty())
+
+		r = newReconciler(newService(false, corev1.ServiceTypeLoadBalancer))
+		Expect(r.serviceForEndpointSlice(context.Background(), newSlice(key.Name))).To(BeEmpty())
+	})
+
+	It("should map workloads to the monitored Services selecting them", func() {
+		service := newService(true, corev1.ServiceTypeLoadBalancer)
+		service.Spec.Selector = map[string]string{"app": "lb"}
+		statefulSet := &appsv1.StatefulSet{
+			ObjectMeta: metav1.ObjectMeta{Name: "lb", Namespace: key.Namespace},
+			Spec: appsv1.StatefulSetSpec{Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"app": "lb", "tier": "edge"}},
+			}},
+		}
+		Expect(newReconciler(service).servicesForWorkload(context.Background(), statefulSet)).To(ConsistOf(
+			reconcile.Request{NamespacedName: key},
+		))
+
+		service.Annotations = nil
+		Expect(newReconciler(service).servicesForWorkload(context.Background(), statefulSet)).To(BeEmpty())
+	})
+
+	It("should report invalid settings once instead of retrying", func() {
+		calls := fakeAPI()
+		service := newService(true, corev1.ServiceTypeLoadBalancer)
+		service.Annotations[utils.HealthCheckMethod] = "FETCH"
+		recorder := record.NewFakeRecorder(10)
+		r := newReconciler(service, newSlice(key.Name))
+		r.Recorder = recorder
+
+		result, err := r.Reconcile(context.Background(), reconcile.Request{NamespacedName: key})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.Requeue).To(BeFalse())
+		Expect(recorder.Events).To(Receive(ContainSubstring("InvalidHealthCheck")))
+		Expect(calls.get()).To(BeEmpty())
+	})
+
+	It("should delete the checks over the quota and report it once", func() {
+		calls := fakeAPI()
+		Expect(utils.Checks.EnsureSynced(context.Background())).To(Succeed())
+		for id, check := range map[string][2]string{
+			"other": {utils.OwnerKey("Ingress", key.Namespace, "web"), ""},
+			"own":   {owner, "80"},
+		} {
+			utils.Checks.Put(utils.RemoteCheck{ID: id, Labels: map[string]string{
+				utils.ManagedByLabel: utils.ManagedByValue, utils.ClusterLabel: utils.ClusterName,
+				utils.OwnerLabel: check[0], utils.CheckKeyLabel: check[1],
+			}})
+		}
+		maxChecks := int32(2)
+		policy := &monitoringv1alpha1.HealthCheckPolicy{
+			ObjectMeta: metav1.ObjectMeta{Name: "quota", Namespace: key.Namespace},
+			Spec:       monitoringv1alpha1.HealthCheckPolicySpec{MaxChecks: &maxChecks},
+		}
+		recorder := record.NewFakeRecorder(10)
+		r := newReconciler(newService(true, corev1.ServiceTypeLoadBalancer), newSlice(key.Name), policy)
+		r.Recorder = recorder
+		DeferCleanup(forgetViolations, owner)
+
+		reconcileService(r)
+		Expect(calls.get()).To(ConsistOf("GET /api/v1/healthchecks", "DELETE /api/v1/healthchecks/own"))
+		Expect(utils.Checks.ByOwner(owner)).To(BeEmpty())
+		Expect(recorder.Events).To(Receive(And(ContainSubstring("PolicyViolation"), ContainSubstring(utils.PolicyMaxChecks))))
+		Expect(testutil.ToFloat64(metrics.PolicyViolations.WithLabelValues(owner, utils.PolicyMaxChecks))).To(Equal(1.0))
+
+		reconcileService(r)
+		Expect(recorder.Events).NotTo(Receive())
+		Expect(calls.get()).To(HaveLen(2))
+	})
+})
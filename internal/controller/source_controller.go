@@ -0,0 +1,272 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	monitoringv1alpha1 "github.com/wentidev/agent/api/v1alpha1"
+	"github.com/wentidev/agent/internal/metrics"
+	"github.com/wentidev/agent/internal/tracing"
+	"github.com/wentidev/agent/internal/utils"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// CheckFunc derives the checks of an object, ErrNoHost when it has none
+type CheckFunc func(ctx context.Context, c client.Reader, obj *unstructured.Unstructured) ([]utils.IngressInfo, error)
+
+// MapFunc maps a related object to the objects of a source to reconcile
+type MapFunc func(ctx context.Context, c client.Reader, obj client.Object) []reconcile.Request
+
+// Source is a kind of object checks are derived from
+type Source struct {
+	GVK    schema.GroupVersionKind
+	Checks CheckFunc
+	// Related are other kinds whose changes affect the checks of the source
+	Related map[schema.GroupVersionKind]MapFunc
+	// OwnerKind is the kind recorded in the owner of the checks, the kind of GVK when empty
+	OwnerKind string
+}
+
+func (s Source) ownerKind() string {
+	if s.OwnerKind != "" {
+		return s.OwnerKind
+	}
+	return s.GVK.Kind
+}
+
+// ConfiguredSources returns the sources declared in the agent configuration file
+func ConfiguredSources(config utils.Config) ([]Source, error) {
+	sources := make([]Source, 0, len(config.Sources))
+	for _, source := range config.Sources {
+		checks, err := source.Compile()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", source.GVK(), err)
+		}
+		sources = append(sources, Source{GVK: source.GVK(), Checks: pure(checks), OwnerKind: source.OwnerKind()})
+	}
+	return sources, nil
+}
+
+// pure adapts a conversion which needs nothing but the object to a CheckFunc
+func pure(checks func(obj *unstructured.Unstructured) ([]utils.IngressInfo, error)) CheckFunc {
+	return func(_ context.Context, _ client.Reader, obj *unstructured.Unstructured) ([]utils.IngressInfo, error) {
+		return checks(obj)
+	}
+}
+
+// OptionalSources are the kinds watched by a SourceReconciler when the cluster serves them
+var OptionalSources = []Source{
+	{GVK: utils.RouteGVK, Checks: pure(utils.RouteChecks)},
+	{GVK: utils.TraefikIngressRouteGVK, Checks: pure(utils.TraefikChecks)},
+	{GVK: utils.LegacyTraefikIngressRouteGVK, Checks: pure(utils.TraefikChecks), OwnerKind: utils.LegacyTraefikOwnerKind},
+	{GVK: utils.HTTPProxyGVK, Checks: pure(utils.HTTPProxyChecks)},
+	{
+		GVK:    utils.VirtualServiceGVK,
+		Checks: virtualServiceChecks,
+		Related: map[schema.GroupVersionKind]MapFunc{
+			utils.IstioGatewayGVK:                         virtualServicesForGateway,
+			corev1.SchemeGroupVersion.WithKind("Service"): virtualServicesForService,
+		},
+	},
+	{
+		GVK:     utils.GRPCRouteGVK,
+		Checks:  gatewayRouteChecks,
+		Related: map[schema.GroupVersionKind]MapFunc{utils.GatewayGVK: routesForGateway(utils.GRPCRouteGVK)},
+	},
+	{
+		GVK:     utils.TLSRouteGVK,
+		Checks:  gatewayRouteChecks,
+		Related: map[schema.GroupVersionKind]MapFunc{utils.GatewayGVK: routesForGateway(utils.TLSRouteGVK)},
+	},
+}
+
+// SourceReconciler monitors the objects of a kind the agent has no Go types for, such as
+// OpenShift Routes, read as unstructured objects and converted to checks by the Source
+type SourceReconciler struct {
+	client.Client
+	Recorder record.EventRecorder
+
+	Source
+	// MaxConcurrentReconciles is the number of objects reconciled in parallel
+	MaxConcurrentReconciles int
+
+	// maintenance tracks whether each object was last seen in a maintenance window
+	maintenance sync.Map
+}
+
+// +kubebuilder:rbac:groups=route.openshift.io,resources=routes,verbs=get;list;watch
+// +kubebuilder:rbac:groups=traefik.io;traefik.containo.us,resources=ingressroutes,verbs=get;list;watch
+// +kubebuilder:rbac:groups=projectcontour.io,resources=httpproxies,verbs=get;list;watch
+// +kubebuilder:rbac:groups=networking.istio.io,resources=gateways;virtualservices,verbs=get;list;watch
+// +kubebuilder:rbac:groups=gateway.networking.k8s.io,resources=gateways;grpcroutes;tlsroutes,verbs=get;list;watch
+
+func (r *SourceReconciler) Reconcile(ctx context.Context, req ctrl.Request) (result ctrl.Result, err error) {
+	ctx, span := tracing.Tracer().Start(ctx, "Reconcile "+r.GVK.Kind, trace.WithAttributes(
+		attribute.String("k8s.namespace.name", req.Namespace),
+		attribute.String("k8s.object.name", req.Name),
+	))
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, "reconcile failed")
+		}
+		span.End()
+		metrics.ObserveReconcile(req.Namespace, err)
+	}()
+
+	owner := utils.OwnerKey(r.ownerKind(), req.Namespace, req.Name)
+	obj := r.newObject()
+	err = r.Get(ctx, req.NamespacedName, obj)
+	if apierrors.IsNotFound(err) {
+		r.maintenance.Delete(req.NamespacedName)
+		return ctrl.Result{}, dropChecks(ctx, owner)
+	}
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	checks, maintenance, err := r.DesiredChecks(ctx, obj)
+	if errors.Is(err, utils.ErrNoHost) {
+		log.Log.Info("object has no host to monitor", "owner", owner)
+		return ctrl.Result{}, dropChecks(ctx, owner)
+	}
+	if err != nil {
+		return ctrl.Result{}, reportInvalidCheck(r.Recorder, obj, err)
+	}
+
+	if _, err := reconcileChecks(ctx, r.Client, r.Recorder, obj, owner, checks); err != nil {
+		return ctrl.Result{}, err
+	}
+	recordMaintenance(r.Recorder, &r.maintenance, obj, maintenance)
+
+	if !maintenance.NextTransition.IsZero() {
+		result.RequeueAfter = time.Until(maintenance.NextTransition)
+	}
+	return result, nil
+}
+
+// DesiredChecks builds the checks of the object, clamped to the policies of its namespace and
+// disabled during maintenance windows of the object or its namespace
+func (r *SourceReconciler) DesiredChecks(ctx context.Context, obj *unstructured.Unstructured) ([]utils.IngressInfo, utils.Maintenance, error) {
+	checks, err := r.Checks(ctx, r.Client, obj)
+	if err != nil {
+		return nil, utils.Maintenance{}, err
+	}
+	maintenance, err := maintenanceState(ctx, r.Client, r.Recorder, obj)
+	if err != nil {
+		log.Log.Error(err, "unable to determine maintenance window")
+		return nil, utils.Maintenance{}, err
+	}
+	if maintenance.Active {
+		for i := range checks {
+			checks[i].Enabled = false
+		}
+	}
+	if err := applyPolicy(ctx, r.Client, obj.GetNamespace(), checks); err != nil {
+		return nil, utils.Maintenance{}, err
+	}
+	return checks, maintenance, nil
+}
+
+func (r *SourceReconciler) newObject() *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{}
+	obj.SetGroupVersionKind(r.GVK)
+	return obj
+}
+
+// objectsForNamespace maps a Namespace to all the objects of the kind it contains
+func (r *SourceReconciler) objectsForNamespace(ctx context.Context, obj client.Object) []reconcile.Request {
+	list := &unstructured.UnstructuredList{}
+	list.SetGroupVersionKind(r.GVK.GroupVersion().WithKind(r.GVK.Kind + "List"))
+	if err := r.List(ctx, list, client.InNamespace(obj.GetName())); err != nil {
+		return nil
+	}
+
+	requests := make([]reconcile.Request, 0, len(list.Items))
+	for _, item := range list.Items {
+		requests = append(requests, reconcile.Request{
+			NamespacedName: types.NamespacedName{Namespace: item.GetNamespace(), Name: item.GetName()},
+		})
+	}
+	return requests
+}
+
+// relatedObject returns the object watched for a related kind: its Go type when the scheme
+// has one, so that kinds such as Services share the typed cache of the other reconcilers
+// instead of opening an unstructured informer of their own
+func relatedObject(scheme *runtime.Scheme, gvk schema.GroupVersionKind) (client.Object, error) {
+	if !scheme.Recognizes(gvk) {
+		related := &unstructured.Unstructured{}
+		related.SetGroupVersionKind(gvk)
+		return related, nil
+	}
+	obj, err := scheme.New(gvk)
+	if err != nil {
+		return nil, err
+	}
+	related, ok := obj.(client.Object)
+	if !ok {
+		return nil, fmt.Errorf("%s is not an object", gvk)
+	}
+	return related, nil
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *SourceReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	b := ctrl.NewControllerManagedBy(mgr).
+		For(r.newObject(), builder.WithPredicates(sourcePredicates())).
+		Watches(&corev1.Namespace{}, handler.EnqueueRequestsFromMapFunc(r.objectsForNamespace),
+			builder.WithPredicates(predicate.AnnotationChangedPredicate{})).
+		Watches(&monitoringv1alpha1.HealthCheckPolicy{}, policyHandler(r.objectsForNamespace)).
+		Watches(&monitoringv1alpha1.ClusterHealthCheckPolicy{}, policyHandler(r.objectsForNamespace))
+	for gvk, mapFunc := range r.Related {
+		related, err := relatedObject(mgr.GetScheme(), gvk)
+		if err != nil {
+			return err
+		}
+		b = b.Watches(related, handler.EnqueueRequestsFromMapFunc(func(ctx context.Context, obj client.Object) []reconcile.Request {
+			return mapFunc(ctx, r.Client, obj)
+		}), builder.WithPredicates(fieldChangedPredicate("spec")))
+	}
+	return b.
+		Named(strings.ToLower(r.ownerKind())).
+		WithOptions(controller.Options{MaxConcurrentReconciles: r.MaxConcurrentReconciles}).
+		Complete(r)
+}
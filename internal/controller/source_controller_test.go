@@ -0,0 +1,103 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/wentidev/agent/internal/utils"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
+)
+
+var _ = Describe("Source controller", func() {
+	newRoute := func(host string) *unstructured.Unstructured {
+		route := &unstructured.Unstructured{}
+		route.SetGroupVersionKind(utils.RouteGVK)
+		route.SetNamespace("shop")
+		route.SetName("web")
+		route.SetGeneration(1)
+		if host != "" {
+			Expect(unstructured.SetNestedSlice(route.Object, []interface{}{
+				map[string]interface{}{"host": host},
+			}, "status", "ingress")).To(Succeed())
+		}
+		return route
+	}
+
+	It("should reconcile Routes when the router assigns their host", func() {
+		pending, admitted := newRoute(""), newRoute("web-shop.apps.example.com")
+		Expect(sourcePredicates().Update(event.UpdateEvent{ObjectOld: pending, ObjectNew: admitted})).To(BeTrue())
+		Expect(sourcePredicates().Update(event.UpdateEvent{ObjectOld: admitted, ObjectNew: admitted.DeepCopy()})).To(BeFalse())
+
+		checks, err := utils.RouteChecks(admitted)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(checks[0].Target).To(Equal("web-shop.apps.example.com"))
+	})
+
+	It("should set up a controller for every optional source", func() {
+		// The manager only reaches the API server once started
+		mgr, err := ctrl.NewManager(&rest.Config{Host: "https://127.0.0.1:6443"}, ctrl.Options{
+			Scheme:  scheme.Scheme,
+			Metrics: metricsserver.Options{BindAddress: "0"},
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		owners := map[string]bool{}
+		for _, source := range OptionalSources {
+			Expect(owners).NotTo(HaveKey(strings.ToLower(source.ownerKind())), source.GVK.String())
+			owners[strings.ToLower(source.ownerKind())] = true
+			Expect((&SourceReconciler{Client: mgr.GetClient(), Source: source}).SetupWithManager(mgr)).
+				To(Succeed(), source.GVK.String())
+		}
+	})
+
+	It("should reconcile configured sources when their status sets the host", func() {
+		knative := schema.GroupVersionKind{Group: "serving.knative.dev", Version: "v1", Kind: "Service"}
+		sources, err := ConfiguredSources(utils.Config{Sources: []utils.SourceConfig{{
+			Group: knative.Group, Version: knative.Version, Kind: knative.Kind, Resource: "services",
+			Hosts: utils.Expression{JSONPath: "{.status.url}"},
+		}}})
+		Expect(err).NotTo(HaveOccurred())
+
+		pending := &unstructured.Unstructured{}
+		pending.SetGroupVersionKind(knative)
+		pending.SetNamespace("shop")
+		pending.SetName("web")
+		ready := pending.DeepCopy()
+		Expect(unstructured.SetNestedField(ready.Object, "https://web.shop.example.com", "status", "url")).To(Succeed())
+		Expect(sourcePredicates().Update(event.UpdateEvent{ObjectOld: pending, ObjectNew: ready})).To(BeTrue())
+
+		r := &SourceReconciler{Client: fake.NewClientBuilder().Build(), Source: sources[0]}
+		_, _, err = r.DesiredChecks(context.Background(), pending)
+		Expect(err).To(MatchError(utils.ErrNoHost))
+		checks, _, err := r.DesiredChecks(context.Background(), ready)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(checks).To(HaveLen(1))
+		Expect(checks[0].Target).To(Equal("web.shop.example.com"))
+	})
+})
@@ -0,0 +1,147 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/wentidev/agent/internal/metrics"
+	"github.com/wentidev/agent/internal/utils"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+)
+
+// statusPoller returns the runnable reflecting the status of the synced checks every interval.
+// It reads the ingresses from the cache and only calls the server for the state of the checks,
+// and stops once the server turned out not to report it.
+func (r *IngressReconciler) statusPoller(interval time.Duration) manager.RunnableFunc {
+	return func(ctx context.Context) error {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for !r.statusUnsupported.Load() {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-ticker.C:
+				r.pollStatus(ctx)
+			}
+		}
+		return nil
+	}
+}
+
+// pollStatus reflects the status of the check of every synced ingress
+func (r *IngressReconciler) pollStatus(ctx context.Context) {
+	r.synced.Range(func(key, value any) bool {
+		ingress := &networkingv1.Ingress{}
+		if err := r.Get(ctx, key.(types.NamespacedName), ingress); err != nil {
+			return ctx.Err() == nil
+		}
+		if err := r.reflectStatus(ctx, ingress, value.(utils.IngressInfo)); err != nil {
+			log.Log.Error(err, "unable to reflect health check status", "ingress", key)
+		}
+		return ctx.Err() == nil && !r.statusUnsupported.Load()
+	})
+}
+
+// reflectStatus reads the live state of the health check and surfaces it on the ingress
+func (r *IngressReconciler) reflectStatus(ctx context.Context, ingress *networkingv1.Ingress, ingressInfo utils.IngressInfo) error {
+	status := utils.CheckStatusDisabled
+	if ingressInfo.Enabled {
+		var err error
+		status, err = utils.GetHealthCheckStatus(ctx, ingressInfo)
+		if errors.Is(err, utils.ErrStatusUnsupported) {
+			r.disableStatus()
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return r.applyStatus(ctx, ingress, ingressInfo.Target, status)
+}
+
+// applyStatus surfaces the state of the check of the ingress as an annotation, Events on
+// up/down transitions and the wenti_check_up gauge
+func (r *IngressReconciler) applyStatus(ctx context.Context, ingress *networkingv1.Ingress, target, status string) error {
+	labels := prometheus.Labels{"namespace": ingress.Namespace, "ingress": ingress.Name, "host": target}
+	switch status {
+	case utils.CheckStatusUp:
+		metrics.CheckUp.With(labels).Set(1)
+	case utils.CheckStatusDown:
+		metrics.CheckUp.With(labels).Set(0)
+	default:
+		metrics.CheckUp.Delete(labels)
+	}
+
+	// Under --dry-run only the gauge follows the check, the annotation is never written
+	// and without it a transition would be reported on every poll
+	previous := utils.GetStringAnnotation(ingress, utils.HealthCheckStatus)
+	if previous == status || utils.DryRun {
+		return nil
+	}
+
+	if r.Recorder != nil {
+		switch status {
+		case utils.CheckStatusUp:
+			r.Recorder.Eventf(ingress, corev1.EventTypeNormal, "CheckUp", "Health check for %s is up", target)
+		case utils.CheckStatusDown:
+			r.Recorder.Eventf(ingress, corev1.EventTypeWarning, "CheckDown", "Health check for %s is down", target)
+		}
+	}
+
+	patch := client.MergeFrom(ingress.DeepCopy())
+	if ingress.Annotations == nil {
+		ingress.Annotations = map[string]string{}
+	}
+	ingress.Annotations[utils.HealthCheckStatus] = status
+	return r.Patch(ctx, ingress, patch)
+}
+
+// disableStatus stops reflecting the status of the checks once the server turned out not to
+// report it, rather than marking every check unknown
+func (r *IngressReconciler) disableStatus() {
+	if r.statusUnsupported.Swap(true) {
+		return
+	}
+	log.Log.Info("the server does not report the state of health checks, no longer polling it")
+	r.synced.Range(func(key, _ any) bool {
+		r.synced.Delete(key)
+		return true
+	})
+}
+
+// checkState is the state under which a managed check is counted
+func checkState(ingressInfo utils.IngressInfo) string {
+	if ingressInfo.Enabled {
+		return "enabled"
+	}
+	return "disabled"
+}
+
+// forgetStatus stops polling the status of a deleted ingress and drops its gauge series
+func (r *IngressReconciler) forgetStatus(key types.NamespacedName) {
+	r.synced.Delete(key)
+	metrics.CheckUp.DeletePartialMatch(prometheus.Labels{"namespace": key.Namespace, "ingress": key.Name})
+}
@@ -0,0 +1,113 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/wentidev/agent/internal/metrics"
+	"github.com/wentidev/agent/internal/utils"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("Status reflection", func() {
+	key := types.NamespacedName{Namespace: "shop", Name: "web"}
+	var (
+		r        *IngressReconciler
+		recorder *record.FakeRecorder
+	)
+
+	BeforeEach(func() {
+		ingress := &networkingv1.Ingress{ObjectMeta: metav1.ObjectMeta{Name: key.Name, Namespace: key.Namespace}}
+		recorder = record.NewFakeRecorder(10)
+		r = &IngressReconciler{Client: fake.NewClientBuilder().WithObjects(ingress).Build(), Recorder: recorder}
+		DeferCleanup(func() { r.forgetStatus(key) })
+	})
+
+	status := func() string {
+		ingress := &networkingv1.Ingress{}
+		Expect(r.Get(context.Background(), key, ingress)).To(Succeed())
+		return ingress.Annotations[utils.HealthCheckStatus]
+	}
+
+	It("should surface transitions as an annotation, Events and the gauge", func() {
+		ingress := &networkingv1.Ingress{}
+		Expect(r.Get(context.Background(), key, ingress)).To(Succeed())
+
+		Expect(r.applyStatus(context.Background(), ingress, "shop.example.com", utils.CheckStatusDown)).To(Succeed())
+		Expect(status()).To(Equal(utils.CheckStatusDown))
+		Expect(recorder.Events).To(Receive(ContainSubstring("CheckDown")))
+		Expect(testutil.ToFloat64(metrics.CheckUp.WithLabelValues(key.Namespace, key.Name, "shop.example.com"))).To(BeZero())
+
+		// An unchanged state is neither patched nor reported again
+		Expect(r.applyStatus(context.Background(), ingress, "shop.example.com", utils.CheckStatusDown)).To(Succeed())
+		Expect(recorder.Events).NotTo(Receive())
+	})
+
+	It("should poll the synced checks without reconciling", func() {
+		r.synced.Store(key, utils.IngressInfo{Target: "shop.example.com", Enabled: false})
+		r.pollStatus(context.Background())
+		Expect(status()).To(Equal(utils.CheckStatusDisabled))
+
+		r.forgetStatus(key)
+		Expect(r.Patch(context.Background(), &networkingv1.Ingress{ObjectMeta: metav1.ObjectMeta{
+			Name: key.Name, Namespace: key.Namespace, Annotations: map[string]string{utils.HealthCheckStatus: "up"},
+		}}, client.Merge)).To(Succeed())
+		r.pollStatus(context.Background())
+		Expect(status()).To(Equal("up"))
+	})
+
+	It("should not write to the cluster under dry run", func() {
+		dryRun := utils.DryRun
+		utils.DryRun = true
+		DeferCleanup(func() { utils.DryRun = dryRun })
+
+		ingress := &networkingv1.Ingress{}
+		Expect(r.Get(context.Background(), key, ingress)).To(Succeed())
+		Expect(r.applyStatus(context.Background(), ingress, "shop.example.com", utils.CheckStatusUp)).To(Succeed())
+		Expect(status()).To(BeEmpty())
+		Expect(recorder.Events).NotTo(Receive())
+		Expect(testutil.ToFloat64(metrics.CheckUp.WithLabelValues(key.Namespace, key.Name, "shop.example.com"))).To(Equal(1.0))
+	})
+	It("should stop polling when the server does not report the state of its checks", func() {
+		calls := fakeAPI()
+		owner := utils.OwnerKey("Ingress", key.Namespace, key.Name)
+		Expect(utils.Checks.EnsureSynced(context.Background())).To(Succeed())
+		utils.Checks.Put(utils.RemoteCheck{ID: "7", Labels: map[string]string{
+			utils.ManagedByLabel: utils.ManagedByValue, utils.ClusterLabel: utils.ClusterName, utils.OwnerLabel: owner,
+		}})
+		r.synced.Store(key, utils.IngressInfo{Owner: owner, Target: "shop.example.com", Enabled: true})
+
+		r.pollStatus(context.Background())
+		Expect(calls.get()).To(ContainElement("GET /api/v1/healthchecks/7"))
+		Expect(status()).To(BeEmpty())
+		Expect(r.statusUnsupported.Load()).To(BeTrue())
+		_, polled := r.synced.Load(key)
+		Expect(polled).To(BeFalse())
+		Expect(r.statusPoller(time.Millisecond)(context.Background())).To(Succeed())
+	})
+})
@@ -0,0 +1,106 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	monitoringv1alpha1 "github.com/wentidev/agent/api/v1alpha1"
+	"github.com/wentidev/agent/internal/utils"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// templateIndex indexes Ingresses by the name of the template they reference
+const templateIndex = ".metadata.annotations.template"
+
+// indexTemplate is the IndexerFunc for templateIndex
+func indexTemplate(obj client.Object) []string {
+	if name := obj.GetAnnotations()[utils.HealthCheckTemplate]; name != "" {
+		return []string{name}
+	}
+	return nil
+}
+
+// resolveTemplate returns the spec of the template the ingress references: the
+// HealthCheckTemplate of its namespace, else the ClusterHealthCheckTemplate of that name
+func resolveTemplate(ctx context.Context, c client.Reader, ingress *networkingv1.Ingress) (*monitoringv1alpha1.HealthCheckTemplateSpec, error) {
+	name := ingress.Annotations[utils.HealthCheckTemplate]
+	if name == "" {
+		return nil, nil
+	}
+
+	template := &monitoringv1alpha1.HealthCheckTemplate{}
+	err := c.Get(ctx, types.NamespacedName{Namespace: ingress.Namespace, Name: name}, template)
+	if err == nil {
+		return &template.Spec, nil
+	}
+	if !apierrors.IsNotFound(err) {
+		return nil, err
+	}
+
+	clusterTemplate := &monitoringv1alpha1.ClusterHealthCheckTemplate{}
+	err = c.Get(ctx, types.NamespacedName{Name: name}, clusterTemplate)
+	if apierrors.IsNotFound(err) {
+		return nil, fmt.Errorf("%w: %s", utils.ErrTemplateNotFound, name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &clusterTemplate.Spec, nil
+}
+
+// reportMissingTemplate emits a Warning Event on an Ingress referencing a missing template,
+// which is reconciled again once the template is created
+func (r *IngressReconciler) reportMissingTemplate(ingress *networkingv1.Ingress, err error) {
+	if r.Recorder == nil {
+		return
+	}
+	r.Recorder.Eventf(ingress, corev1.EventTypeWarning, "TemplateNotFound", "%v", err)
+}
+
+// ingressesForTemplate maps a HealthCheckTemplate to the Ingresses of its namespace referencing it
+func (r *IngressReconciler) ingressesForTemplate(ctx context.Context, obj client.Object) []reconcile.Request {
+	return r.ingressesReferencing(ctx, obj.GetName(), client.InNamespace(obj.GetNamespace()))
+}
+
+// ingressesForClusterTemplate maps a ClusterHealthCheckTemplate to the Ingresses referencing it,
+// including the ones whose namespace has a template of the same name, which is cheap to reconcile
+func (r *IngressReconciler) ingressesForClusterTemplate(ctx context.Context, obj client.Object) []reconcile.Request {
+	return r.ingressesReferencing(ctx, obj.GetName())
+}
+
+func (r *IngressReconciler) ingressesReferencing(ctx context.Context, name string, opts ...client.ListOption) []reconcile.Request {
+	ingresses := &networkingv1.IngressList{}
+	opts = append(opts, client.MatchingFields{templateIndex: name})
+	if err := r.List(ctx, ingresses, opts...); err != nil {
+		return nil
+	}
+
+	requests := make([]reconcile.Request, 0, len(ingresses.Items))
+	for _, ingress := range ingresses.Items {
+		requests = append(requests, reconcile.Request{
+			NamespacedName: types.NamespacedName{Namespace: ingress.Namespace, Name: ingress.Name},
+		})
+	}
+	return requests
+}
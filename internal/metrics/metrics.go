@@ -0,0 +1,191 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package metrics holds the Prometheus collectors of the agent. They are registered
+// with the controller-runtime registry and served by the manager's metrics server.
+package metrics
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	ctrlmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+var (
+	// APIRequests counts the calls made to the Wenti API
+	APIRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "wenti_api_requests_total",
+		Help: "Number of Wenti API calls by operation and status code.",
+	}, []string{"operation", "code"})
+
+	// APIRequestDuration observes the latency of the calls made to the Wenti API
+	APIRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "wenti_api_request_duration_seconds",
+		Help:    "Latency of Wenti API calls by operation and status code.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"operation", "code"})
+
+	// APIThrottled counts the Wenti API calls delayed by the client-side rate limiter
+	APIThrottled = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "wenti_api_throttled_requests_total",
+		Help: "Number of Wenti API calls delayed by the client-side rate limiter.",
+	})
+
+	// APIThrottleWait observes how long throttled Wenti API calls waited for the rate limiter
+	APIThrottleWait = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "wenti_api_throttle_wait_seconds",
+		Help:    "Time throttled Wenti API calls waited for the client-side rate limiter.",
+		Buckets: prometheus.DefBuckets,
+	})
+
+	// DryRunOperations counts the writes skipped in dry-run mode
+	DryRunOperations = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "wenti_dry_run_operations_total",
+		Help: "Number of Wenti API writes skipped in dry-run mode by operation.",
+	}, []string{"operation"})
+
+	// ManagedChecks reports the number of health checks managed by the agent
+	ManagedChecks = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "wenti_managed_checks",
+		Help: "Number of health checks managed by the agent by state.",
+	}, []string{"state"})
+
+	// Reconciles counts reconcile outcomes
+	Reconciles = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "wenti_reconcile_total",
+		Help: "Number of reconciles by namespace and result.",
+	}, []string{"namespace", "result"})
+
+	// SecondsSinceLastSync reports the time elapsed since the last successful sync
+	SecondsSinceLastSync = prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "wenti_seconds_since_last_sync",
+		Help: "Seconds since a health check was last successfully synced, or since start if none was.",
+	}, func() float64 {
+		return time.Since(lastSync()).Seconds()
+	})
+
+	// CheckUp reports the live state of each health check, 1 when up and 0 when down
+	CheckUp = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "wenti_check_up",
+		Help: "Whether the Wenti health check of an Ingress is up (1) or down (0).",
+	}, []string{"namespace", "ingress", "host"})
+
+	// PolicyViolations reports the checks of each owner currently breaking a HealthCheckPolicy rule
+	PolicyViolations = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "wenti_policy_violations",
+		Help: "Number of health checks breaking a HealthCheckPolicy rule by owner and rule.",
+	}, []string{"owner", "rule"})
+)
+
+func init() {
+	ctrlmetrics.Registry.MustRegister(
+		CheckUp,
+		APIRequests,
+		APIRequestDuration,
+		APIThrottled,
+		APIThrottleWait,
+		DryRunOperations,
+		ManagedChecks,
+		Reconciles,
+		SecondsSinceLastSync,
+		PolicyViolations,
+	)
+}
+
+// ObserveAPICall records a Wenti API call started at start, a zero code means the request failed
+func ObserveAPICall(operation string, code int, start time.Time) {
+	status := "error"
+	if code != 0 {
+		status = strconv.Itoa(code)
+	}
+	APIRequests.WithLabelValues(operation, status).Inc()
+	APIRequestDuration.WithLabelValues(operation, status).Observe(time.Since(start).Seconds())
+}
+
+// ObserveReconcile records the outcome of a reconcile in namespace
+func ObserveReconcile(namespace string, err error) {
+	result := "success"
+	if err != nil {
+		result = "error"
+	}
+	Reconciles.WithLabelValues(namespace, result).Inc()
+}
+
+var (
+	syncMu     sync.Mutex
+	lastSyncAt = time.Now()
+	// checkStates holds the state of every managed check by owner and by check key
+	checkStates = map[string]map[string]string{}
+)
+
+func lastSync() time.Time {
+	syncMu.Lock()
+	defer syncMu.Unlock()
+	return lastSyncAt
+}
+
+// SetManagedCheck records a successful sync of the check owned by key in the given state
+func SetManagedCheck(key, state string) {
+	SetManagedChecks(key, map[string]string{"": state})
+}
+
+// SetManagedChecks records a successful sync of the checks owned by key, in the given
+// states by check key, replacing the checks previously recorded for key
+func SetManagedChecks(key string, states map[string]string) {
+	syncMu.Lock()
+	defer syncMu.Unlock()
+	lastSyncAt = time.Now()
+	checkStates[key] = states
+	updateManagedChecks()
+}
+
+// ForgetManagedCheck stops counting the checks owned by key
+func ForgetManagedCheck(key string) {
+	syncMu.Lock()
+	defer syncMu.Unlock()
+	delete(checkStates, key)
+	updateManagedChecks()
+}
+
+func updateManagedChecks() {
+	counts := map[string]int{}
+	for _, states := range checkStates {
+		for _, state := range states {
+			counts[state]++
+		}
+	}
+	ManagedChecks.Reset()
+	for state, count := range counts {
+		ManagedChecks.WithLabelValues(state).Set(float64(count))
+	}
+}
+
+// SetPolicyViolations records the number of checks owned by key breaking each rule,
+// replacing the rules previously recorded for key
+func SetPolicyViolations(key string, counts map[string]int) {
+	PolicyViolations.DeletePartialMatch(prometheus.Labels{"owner": key})
+	for rule, count := range counts {
+		PolicyViolations.WithLabelValues(key, rule).Set(float64(count))
+	}
+}
+
+// ForgetPolicyViolations stops reporting the violations of the checks owned by key
+func ForgetPolicyViolations(key string) {
+	PolicyViolations.DeletePartialMatch(prometheus.Labels{"owner": key})
+}
@@ -0,0 +1,77 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"errors"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+var _ = Describe("Metrics", func() {
+	It("should label API calls with their status code", func() {
+		ObserveAPICall("create", 201, time.Now())
+		ObserveAPICall("create", 0, time.Now())
+		Expect(testutil.ToFloat64(APIRequests.WithLabelValues("create", "201"))).To(Equal(1.0))
+		Expect(testutil.ToFloat64(APIRequests.WithLabelValues("create", "error"))).To(Equal(1.0))
+		Expect(testutil.CollectAndCount(APIRequestDuration)).To(Equal(2))
+	})
+
+	It("should count reconciles by result", func() {
+		ObserveReconcile("shop", nil)
+		ObserveReconcile("shop", errors.New("unexpected status code 500"))
+		ObserveReconcile("shop", nil)
+		Expect(testutil.ToFloat64(Reconciles.WithLabelValues("shop", "success"))).To(Equal(2.0))
+		Expect(testutil.ToFloat64(Reconciles.WithLabelValues("shop", "error"))).To(Equal(1.0))
+	})
+
+	It("should count managed checks by state", func() {
+		SetManagedCheck("shop/web", "enabled")
+		SetManagedCheck("shop/api", "enabled")
+		SetManagedCheck("shop/api", "disabled")
+		Expect(testutil.ToFloat64(ManagedChecks.WithLabelValues("enabled"))).To(Equal(1.0))
+		Expect(testutil.ToFloat64(ManagedChecks.WithLabelValues("disabled"))).To(Equal(1.0))
+		Expect(lastSync()).To(BeTemporally("~", time.Now(), time.Second))
+
+		SetManagedChecks("Service/shop/lb", map[string]string{"80": "enabled", "443": "disabled"})
+		Expect(testutil.ToFloat64(ManagedChecks.WithLabelValues("enabled"))).To(Equal(2.0))
+		Expect(testutil.ToFloat64(ManagedChecks.WithLabelValues("disabled"))).To(Equal(2.0))
+		SetManagedChecks("Service/shop/lb", map[string]string{"80": "enabled"})
+		Expect(testutil.ToFloat64(ManagedChecks.WithLabelValues("disabled"))).To(Equal(1.0))
+
+		ForgetManagedCheck("shop/web")
+		ForgetManagedCheck("shop/api")
+		ForgetManagedCheck("Service/shop/lb")
+		Expect(testutil.CollectAndCount(ManagedChecks)).To(BeZero())
+	})
+
+	It("should report the current policy violations of each owner", func() {
+		SetPolicyViolations("Ingress/shop/web", map[string]int{"minInterval": 1, "allowedMethods": 1})
+		SetPolicyViolations("Service/shop/lb", map[string]int{"minInterval": 2})
+		SetPolicyViolations("Ingress/shop/web", map[string]int{"minInterval": 1})
+		Expect(testutil.CollectAndCount(PolicyViolations)).To(Equal(2))
+		Expect(testutil.ToFloat64(PolicyViolations.WithLabelValues("Service/shop/lb", "minInterval"))).To(Equal(2.0))
+
+		ForgetPolicyViolations("Ingress/shop/web")
+		SetPolicyViolations("Service/shop/lb", nil)
+		Expect(testutil.CollectAndCount(PolicyViolations)).To(BeZero())
+	})
+})
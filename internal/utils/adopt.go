@@ -0,0 +1,77 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// HealthCheckID holds the ID of the check an Ingress owns, recorded when an existing check is adopted
+var HealthCheckID string = "wenti.dev/health-check-id"
+
+// ErrAmbiguousMatch is returned when several unmanaged checks match a resource
+var ErrAmbiguousMatch = errors.New("several health checks match")
+
+// matchFields are the settings a MatchRule can compare
+var matchFields = map[string]func(check RemoteCheck, resource IngressInfo) bool{
+	"target": func(check RemoteCheck, resource IngressInfo) bool {
+		return strings.EqualFold(check.Target, resource.Target)
+	},
+	"path": func(check RemoteCheck, resource IngressInfo) bool {
+		return check.Path == resource.Path
+	},
+	"method": func(check RemoteCheck, resource IngressInfo) bool {
+		return strings.EqualFold(check.Method, resource.Method)
+	},
+	"protocol": func(check RemoteCheck, resource IngressInfo) bool {
+		return strings.EqualFold(check.Protocol, resource.Protocol)
+	},
+	"port": func(check RemoteCheck, resource IngressInfo) bool {
+		port, err := ConvertStringToInt(resource.Port)
+		return err == nil && check.Port == port
+	},
+	"name": func(check RemoteCheck, resource IngressInfo) bool {
+		return check.Name == resource.Name
+	},
+}
+
+// MatchRule lists the settings an unmanaged check must share with a resource to be adopted.
+// It implements flag.Value as a comma separated list, which must include the target.
+type MatchRule []string
+
+func (m *MatchRule) String() string {
+	return strings.Join(*m, ",")
+}
+
+func (m *MatchRule) Set(value string) error {
+	rule := MatchRule{}
+	target := false
+	for _, field := range strings.Split(value, ",") {
+		field = strings.ToLower(strings.TrimSpace(field))
+		if _, ok := matchFields[field]; !ok {
+			return fmt.Errorf("unknown match field %q", field)
+		}
+		target = target || field == "target"
+		rule = append(rule, field)
+	}
+	if !target {
+		return fmt.Errorf("the match rule must include the target")
+	}
+	*m = rule
+	return nil
+}
+
+// Matches reports whether the check shares all the settings of the rule with the resource
+func (m MatchRule) Matches(check RemoteCheck, resource IngressInfo) bool {
+	for _, field := range m {
+		if !matchFields[field](check, resource) {
+			return false
+		}
+	}
+	return true
+}
+
+// Unmanaged reports whether no agent manages the check, so that it can be adopted
+func (c RemoteCheck) Unmanaged() bool {
+	return c.Labels[ManagedByLabel] == ""
+}
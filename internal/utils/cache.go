@@ -0,0 +1,319 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// Labels set on the remote checks created by the agent to record their ownership
+const (
+	ManagedByLabel = "wenti.dev/managed-by"
+	ClusterLabel   = "wenti.dev/cluster"
+	OwnerLabel     = "wenti.dev/owner"
+	CheckKeyLabel  = "wenti.dev/check-key"
+
+	ManagedByValue = "wenti-agent"
+)
+
+// OwnerKey identifies the Kubernetes resource a check is derived from
+func OwnerKey(kind, namespace, name string) string {
+	return fmt.Sprintf("%s/%s/%s", kind, namespace, name)
+}
+
+// RemoteCheck is a health check as stored on the server
+type RemoteCheck struct {
+	ID          string            `json:"id"`
+	Name        string            `json:"name"`
+	Description string            `json:"description"`
+	Target      string            `json:"target"`
+	Port        int               `json:"port"`
+	Protocol    string            `json:"protocol"`
+	Path        string            `json:"path"`
+	Method      string            `json:"method"`
+	Timeout     int               `json:"timeout"`
+	Interval    int               `json:"interval"`
+	HTTPCode    string            `json:"httpCode,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`
+}
+
+// Owner returns the owner key of the check, empty if the agent does not manage it
+func (c RemoteCheck) Owner() string {
+	if c.Labels[ManagedByLabel] != ManagedByValue || c.Labels[ClusterLabel] != ClusterName {
+		return ""
+	}
+	return c.Labels[OwnerLabel]
+}
+
+// parseLabels decodes the labels of a check, which the server returns as a JSON document
+func parseLabels(raw *string) map[string]string {
+	labels := map[string]string{}
+	if raw == nil || *raw == "" {
+		return labels
+	}
+	values := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(*raw), &values); err != nil {
+		return labels
+	}
+	for key, value := range values {
+		if s, ok := value.(string); ok {
+			labels[key] = s
+		}
+	}
+	return labels
+}
+
+// ownerLabels returns the labels recording the ownership of the check of the resource
+func ownerLabels(resource IngressInfo) *map[string]interface{} {
+	labels := map[string]interface{}{
+		ManagedByLabel: ManagedByValue,
+		ClusterLabel:   ClusterName,
+	}
+	if resource.Owner != "" {
+		labels[OwnerLabel] = resource.Owner
+	}
+	if resource.Key != "" {
+		labels[CheckKeyLabel] = resource.Key
+	}
+	return &labels
+}
+
+func targetKey(target, method, path string) string {
+	return fmt.Sprintf("%s|%s|%s", target, method, path)
+}
+
+// CheckCache is an in-memory index of the checks on the server, by owner and by target
+type CheckCache struct {
+	mu       sync.RWMutex
+	syncMu   sync.Mutex
+	synced   bool
+	checks   map[string]RemoteCheck
+	byOwner  map[string][]string
+	byTarget map[string][]string
+	// changed records the checks written locally and when, so that a refresh which
+	// started before the write does not revert it. A nil check marks a deletion.
+	changed map[string]localChange
+}
+
+type localChange struct {
+	at    time.Time
+	check *RemoteCheck
+}
+
+// Checks is the cache used by the reconcilers
+var Checks = NewCheckCache()
+
+func NewCheckCache() *CheckCache {
+	return &CheckCache{
+		checks:   map[string]RemoteCheck{},
+		byOwner:  map[string][]string{},
+		byTarget: map[string][]string{},
+		changed:  map[string]localChange{},
+	}
+}
+
+// Synced reports whether the cache was filled at least once
+func (c *CheckCache) Synced() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.synced
+}
+
+// Put records a check created or updated by the agent
+func (c *CheckCache) Put(check RemoteCheck) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.changed[check.ID] = localChange{at: time.Now(), check: &check}
+	c.checks[check.ID] = check
+	c.reindex()
+}
+
+// Delete forgets a check deleted by the agent
+func (c *CheckCache) Delete(id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.changed[id] = localChange{at: time.Now()}
+	delete(c.checks, id)
+	c.reindex()
+}
+
+// Get returns the check with the given ID
+func (c *CheckCache) Get(id string) (RemoteCheck, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	check, ok := c.checks[id]
+	return check, ok
+}
+
+// ByOwner returns the checks owned by the given key
+func (c *CheckCache) ByOwner(owner string) []RemoteCheck {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.lookup(c.byOwner[owner])
+}
+
+// ByTarget returns the checks on the given target, method and path
+func (c *CheckCache) ByTarget(target, method, path string) []RemoteCheck {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.lookup(c.byTarget[targetKey(target, method, path)])
+}
+
+// CountInNamespace returns the number of checks owned by the resources of the namespace,
+// except the ones owned by the given key
+func (c *CheckCache) CountInNamespace(namespace, except string) int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	count := 0
+	for owner, ids := range c.byOwner {
+		if parts := strings.SplitN(owner, "/", 3); len(parts) == 3 && parts[1] == namespace && owner != except {
+			count += len(ids)
+		}
+	}
+	return count
+}
+
+// All returns every cached check
+func (c *CheckCache) All() []RemoteCheck {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	ids := make([]string, 0, len(c.checks))
+	for id := range c.checks {
+		ids = append(ids, id)
+	}
+	return c.lookup(ids)
+}
+
+// Find returns the check of the resource: the one recorded on it, the one it owns, or when
+// adoption is enabled the single unmanaged check matching AdoptMatch
+func (c *CheckCache) Find(resource IngressInfo) (RemoteCheck, bool, error) {
+	if resource.ID != "" {
+		if check, ok := c.Get(resource.ID); ok && (check.Unmanaged() || check.Owner() == resource.Owner) {
+			return check, true, nil
+		}
+	}
+	if resource.Owner != "" {
+		for _, check := range c.ByOwner(resource.Owner) {
+			if check.Labels[CheckKeyLabel] == resource.Key {
+				return check, true, nil
+			}
+		}
+	}
+	if !Adopt || resource.Target == "" {
+		return RemoteCheck{}, false, nil
+	}
+	candidates := c.Candidates(resource, AdoptMatch)
+	switch len(candidates) {
+	case 0:
+		return RemoteCheck{}, false, nil
+	case 1:
+		return candidates[0], true, nil
+	}
+	ids := make([]string, 0, len(candidates))
+	for _, check := range candidates {
+		ids = append(ids, check.ID)
+	}
+	return RemoteCheck{}, false, fmt.Errorf("%w %s: %s", ErrAmbiguousMatch, resource.Target, strings.Join(ids, ", "))
+}
+
+// Candidates returns the unmanaged checks matching the resource under the rule
+func (c *CheckCache) Candidates(resource IngressInfo, rule MatchRule) []RemoteCheck {
+	var candidates []RemoteCheck
+	for _, check := range c.All() {
+		if check.Unmanaged() && rule.Matches(check, resource) {
+			candidates = append(candidates, check)
+		}
+	}
+	return candidates
+}
+
+// EnsureSynced fills the cache unless it already was
+func (c *CheckCache) EnsureSynced(ctx context.Context) error {
+	c.syncMu.Lock()
+	defer c.syncMu.Unlock()
+	if c.Synced() {
+		return nil
+	}
+	return c.Refresh(ctx)
+}
+
+// Refresh replaces the content of the cache with the checks listed from the server
+func (c *CheckCache) Refresh(ctx context.Context) error {
+	start := time.Now()
+	checks, err := ListHealthChecks(ctx)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.checks = make(map[string]RemoteCheck, len(checks))
+	for _, check := range checks {
+		c.checks[check.ID] = check
+	}
+	for id, change := range c.changed {
+		if change.at.Before(start) {
+			delete(c.changed, id)
+			continue
+		}
+		if change.check == nil {
+			delete(c.checks, id)
+		} else {
+			c.checks[id] = *change.check
+		}
+	}
+	c.reindex()
+	c.synced = true
+	return nil
+}
+
+// Run fills the cache and refreshes it every interval until ctx is done, only once when the
+// interval is not positive
+func (c *CheckCache) Run(ctx context.Context, interval time.Duration) error {
+	for {
+		if err := c.Refresh(ctx); err != nil {
+			log.Log.Error(err, "unable to refresh the health check cache")
+		} else {
+			log.Log.Info("health check cache refreshed", "count", len(c.All()))
+		}
+
+		if interval <= 0 {
+			<-ctx.Done()
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(interval):
+		}
+	}
+}
+
+func (c *CheckCache) lookup(ids []string) []RemoteCheck {
+	checks := make([]RemoteCheck, 0, len(ids))
+	for _, id := range ids {
+		if check, ok := c.checks[id]; ok {
+			checks = append(checks, check)
+		}
+	}
+	sort.Slice(checks, func(i, j int) bool { return checks[i].ID < checks[j].ID })
+	return checks
+}
+
+func (c *CheckCache) reindex() {
+	c.byOwner = map[string][]string{}
+	c.byTarget = map[string][]string{}
+	for id, check := range c.checks {
+		if owner := check.Owner(); owner != "" {
+			c.byOwner[owner] = append(c.byOwner[owner], id)
+		}
+		key := targetKey(check.Target, check.Method, check.Path)
+		c.byTarget[key] = append(c.byTarget[key], id)
+	}
+}
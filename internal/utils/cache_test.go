@@ -0,0 +1,134 @@
+package utils
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Check cache", func() {
+	owned := func(id, owner, target string) RemoteCheck {
+		return RemoteCheck{
+			ID:     id,
+			Target: target,
+			Method: "GET",
+			Path:   "/",
+			Labels: map[string]string{
+				ManagedByLabel: ManagedByValue,
+				ClusterLabel:   ClusterName,
+				OwnerLabel:     owner,
+			},
+		}
+	}
+
+	It("should index checks by owner and by target", func() {
+		cache := NewCheckCache()
+		cache.Put(owned("1", OwnerKey("Ingress", "default", "web"), "example.com"))
+		cache.Put(RemoteCheck{ID: "2", Target: "example.com", Method: "GET", Path: "/"})
+
+		Expect(cache.ByOwner(OwnerKey("Ingress", "default", "web"))).To(HaveLen(1))
+		Expect(cache.ByTarget("example.com", "GET", "/")).To(HaveLen(2))
+
+		check, ok, err := cache.Find(IngressInfo{Owner: OwnerKey("Ingress", "default", "web")})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ok).To(BeTrue())
+		Expect(check.ID).To(Equal("1"))
+
+		cache.Delete("1")
+		Expect(cache.ByOwner(OwnerKey("Ingress", "default", "web"))).To(BeEmpty())
+		Expect(cache.ByTarget("example.com", "GET", "/")).To(HaveLen(1))
+	})
+
+	It("should ignore checks owned by another cluster", func() {
+		check := owned("1", OwnerKey("Ingress", "default", "web"), "example.com")
+		check.Labels[ClusterLabel] = "other-" + ClusterName
+		Expect(check.Owner()).To(BeEmpty())
+	})
+
+	It("should decode labels returned as JSON", func() {
+		raw := `{"wenti.dev/owner":"Ingress/default/web","count":3}`
+		Expect(parseLabels(&raw)).To(Equal(map[string]string{OwnerLabel: "Ingress/default/web"}))
+		invalid := "not json"
+		Expect(parseLabels(&invalid)).To(BeEmpty())
+		Expect(parseLabels(nil)).To(BeEmpty())
+	})
+
+	Context("adoption", func() {
+		resource := IngressInfo{Owner: OwnerKey("Ingress", "default", "web"), Target: "example.com",
+			Method: "GET", Path: "/", Port: "443"}
+
+		BeforeEach(func() {
+			Adopt = true
+			DeferCleanup(func() { Adopt = false })
+		})
+
+		It("should adopt the single unmanaged check matching the rule", func() {
+			cache := NewCheckCache()
+			cache.Put(RemoteCheck{ID: "1", Target: "example.com", Method: "get", Path: "/", Port: 443})
+			cache.Put(RemoteCheck{ID: "2", Target: "example.com", Method: "GET", Path: "/healthz"})
+			cache.Put(owned("3", OwnerKey("Ingress", "default", "other"), "example.com"))
+
+			check, ok, err := cache.Find(resource)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ok).To(BeTrue())
+			Expect(check.ID).To(Equal("1"))
+		})
+
+		It("should report ambiguous matches", func() {
+			cache := NewCheckCache()
+			cache.Put(RemoteCheck{ID: "1", Target: "example.com", Method: "GET", Path: "/", Port: 443})
+			cache.Put(RemoteCheck{ID: "2", Target: "example.com", Method: "GET", Path: "/", Port: 80})
+
+			_, ok, err := cache.Find(resource)
+			Expect(err).To(MatchError(ErrAmbiguousMatch))
+			Expect(ok).To(BeFalse())
+
+			rule := MatchRule{}
+			Expect(rule.Set("target, port")).To(Succeed())
+			Expect(cache.Candidates(resource, rule)).To(HaveLen(1))
+		})
+
+		It("should prefer the check recorded on the resource", func() {
+			cache := NewCheckCache()
+			cache.Put(RemoteCheck{ID: "1", Target: "example.com", Method: "GET", Path: "/"})
+			cache.Put(RemoteCheck{ID: "2", Target: "example.com", Method: "GET", Path: "/"})
+
+			withID := resource
+			withID.ID = "2"
+			check, ok, err := cache.Find(withID)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ok).To(BeTrue())
+			Expect(check.ID).To(Equal("2"))
+		})
+
+		It("should reject rules without the target", func() {
+			rule := MatchRule{}
+			Expect(rule.Set("path,method")).NotTo(Succeed())
+			Expect(rule.Set("target,colour")).NotTo(Succeed())
+		})
+	})
+
+	It("should only fill the cache once without a resync interval", func() {
+		var lists atomic.Int32
+		fakeAPI(func(w http.ResponseWriter, r *http.Request) {
+			lists.Add(1)
+			writeJSON(w, http.StatusOK, map[string]interface{}{"http-checks": []interface{}{listedCheck("1", "Ingress/shop/web")}})
+		})
+		for _, interval := range []time.Duration{0, -time.Second} {
+			lists.Store(0)
+			ctx, cancel := context.WithCancel(context.Background())
+			done := make(chan error)
+			go func() { done <- Checks.Run(ctx, interval) }()
+
+			Eventually(lists.Load).Should(Equal(int32(1)))
+			Consistently(lists.Load, 100*time.Millisecond).Should(Equal(int32(1)))
+			Expect(Checks.ByOwner("Ingress/shop/web")).To(HaveLen(1))
+			cancel()
+			Eventually(done).Should(Receive(BeNil()))
+		}
+	})
+})
@@ -0,0 +1,45 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+
+	"sigs.k8s.io/yaml"
+)
+
+// ConfigFile is the path of the agent configuration file, read at startup
+var ConfigFile string
+
+// Config is the agent configuration file, for settings too structured for flags
+type Config struct {
+	// Sources are extra kinds to derive checks from, without a code change per kind
+	Sources []SourceConfig `json:"sources,omitempty"`
+	// Rules select the Ingresses to monitor and compute their settings, see Rule
+	Rules []Rule `json:"rules,omitempty"`
+	// Names are the templates of the names and descriptions of the checks
+	Names NameConfig `json:"names,omitempty"`
+}
+
+// LoadConfig reads and validates the configuration file at path
+func LoadConfig(path string) (Config, error) {
+	var config Config
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return config, err
+	}
+	if err := yaml.UnmarshalStrict(data, &config); err != nil {
+		return config, fmt.Errorf("unable to parse %s: %w", path, err)
+	}
+	for i, source := range config.Sources {
+		if _, err := source.Compile(); err != nil {
+			return config, fmt.Errorf("%s: sources[%d]: %w", path, i, err)
+		}
+	}
+	if _, err := CompileRules(config.Rules); err != nil {
+		return config, fmt.Errorf("%s: %w", path, err)
+	}
+	if _, err := CompileNames(config.Names); err != nil {
+		return config, fmt.Errorf("%s: names: %w", path, err)
+	}
+	return config, nil
+}
@@ -0,0 +1,46 @@
+package utils
+
+import (
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// HTTPProxyGVK is the Contour HTTPProxy kind
+var HTTPProxyGVK = schema.GroupVersionKind{Group: "projectcontour.io", Version: "v1", Kind: "HTTPProxy"}
+
+// HTTPProxyChecks builds one check per path prefix of the routes of a root Contour HTTPProxy
+// on its virtual host. Included proxies have no virtual host and get no check.
+func HTTPProxyChecks(proxy *unstructured.Unstructured) ([]IngressInfo, error) {
+	fqdn, _, _ := unstructured.NestedString(proxy.Object, "spec", "virtualhost", "fqdn")
+	if fqdn == "" {
+		return nil, ErrNoHost
+	}
+
+	targets := []hostPath{{host: fqdn}}
+	routes, _, _ := unstructured.NestedSlice(proxy.Object, "spec", "routes")
+	for _, item := range routes {
+		route, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		conditions, _, _ := unstructured.NestedSlice(route, "conditions")
+		for _, condition := range conditions {
+			spec, ok := condition.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			for _, field := range []string{"prefix", "exact"} {
+				if path, _, _ := unstructured.NestedString(spec, field); path != "" {
+					targets = append(targets, hostPath{host: fqdn, path: pathPrefix(path)})
+				}
+			}
+		}
+	}
+	if len(targets) > 1 {
+		// The routes name the paths, no need to probe the root as well
+		targets = targets[1:]
+	}
+
+	_, tls, _ := unstructured.NestedFieldNoCopy(proxy.Object, "spec", "virtualhost", "tls")
+	return hostPathChecks(proxy, targets, tls)
+}
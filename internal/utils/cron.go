@@ -0,0 +1,155 @@
+package utils
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule is a parsed standard five-field cron expression
+// (minute, hour, day of month, month, day of week) evaluated in UTC
+type Schedule struct {
+	minute     uint64
+	hour       uint64
+	dayOfMonth uint64
+	month      uint64
+	dayOfWeek  uint64
+	// restricted day fields follow the cron rule of matching either of them
+	domRestricted bool
+	dowRestricted bool
+}
+
+type cronField struct {
+	min, max int
+}
+
+var cronFields = []cronField{
+	{0, 59}, // minute
+	{0, 23}, // hour
+	{1, 31}, // day of month
+	{1, 12}, // month
+	{0, 7},  // day of week, 0 and 7 are Sunday
+}
+
+// ParseSchedule parses a five-field cron expression
+func ParseSchedule(spec string) (*Schedule, error) {
+	fields := strings.Fields(spec)
+	if len(fields) != len(cronFields) {
+		return nil, fmt.Errorf("expected %d fields in cron expression %q, got %d", len(cronFields), spec, len(fields))
+	}
+
+	bits := make([]uint64, len(fields))
+	for i, field := range fields {
+		b, err := parseCronField(field, cronFields[i])
+		if err != nil {
+			return nil, fmt.Errorf("invalid cron expression %q: %w", spec, err)
+		}
+		bits[i] = b
+	}
+
+	// Sunday may be written as 7
+	if bits[4]&(1<<7) != 0 {
+		bits[4] |= 1
+	}
+
+	return &Schedule{
+		minute:        bits[0],
+		hour:          bits[1],
+		dayOfMonth:    bits[2],
+		month:         bits[3],
+		dayOfWeek:     bits[4],
+		domRestricted: fields[2] != "*",
+		dowRestricted: fields[4] != "*",
+	}, nil
+}
+
+func parseCronField(field string, bounds cronField) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			s, err := strconv.Atoi(part[i+1:])
+			if err != nil || s <= 0 {
+				return 0, fmt.Errorf("invalid step in %q", part)
+			}
+			step = s
+			part = part[:i]
+		}
+
+		low, high := bounds.min, bounds.max
+		switch {
+		case part == "*":
+		case strings.Contains(part, "-"):
+			r := strings.SplitN(part, "-", 2)
+			l, err := strconv.Atoi(r[0])
+			if err != nil {
+				return 0, fmt.Errorf("invalid range %q", part)
+			}
+			h, err := strconv.Atoi(r[1])
+			if err != nil {
+				return 0, fmt.Errorf("invalid range %q", part)
+			}
+			low, high = l, h
+		default:
+			v, err := strconv.Atoi(part)
+			if err != nil {
+				return 0, fmt.Errorf("invalid value %q", part)
+			}
+			low, high = v, v
+			if step > 1 {
+				high = bounds.max
+			}
+		}
+
+		if low < bounds.min || high > bounds.max || low > high {
+			return 0, fmt.Errorf("value %q out of range [%d-%d]", part, bounds.min, bounds.max)
+		}
+		for v := low; v <= high; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+// maxScheduleLookahead bounds the search for the next activation
+const maxScheduleLookahead = 5 * 366
+
+// Next returns the first activation strictly after t, or the zero time if there is none
+func (s *Schedule) Next(t time.Time) time.Time {
+	t = t.UTC().Truncate(time.Minute).Add(time.Minute)
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+
+	for i := 0; i < maxScheduleLookahead; i++ {
+		if s.matchDay(day) {
+			for h := 0; h < 24; h++ {
+				if s.hour&(1<<uint(h)) == 0 {
+					continue
+				}
+				for m := 0; m < 60; m++ {
+					if s.minute&(1<<uint(m)) == 0 {
+						continue
+					}
+					candidate := day.Add(time.Duration(h)*time.Hour + time.Duration(m)*time.Minute)
+					if !candidate.Before(t) {
+						return candidate
+					}
+				}
+			}
+		}
+		day = day.AddDate(0, 0, 1)
+	}
+	return time.Time{}
+}
+
+func (s *Schedule) matchDay(day time.Time) bool {
+	if s.month&(1<<uint(day.Month())) == 0 {
+		return false
+	}
+	dom := s.dayOfMonth&(1<<uint(day.Day())) != 0
+	dow := s.dayOfWeek&(1<<uint(day.Weekday())) != 0
+	if s.domRestricted && s.dowRestricted {
+		return dom || dow
+	}
+	return dom && dow
+}
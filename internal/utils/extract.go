@@ -0,0 +1,263 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"reflect"
+	"strings"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+	"github.com/google/cel-go/common/types/traits"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/util/jsonpath"
+)
+
+// SourceConfig declares a kind to derive checks from, and the expressions extracting the
+// hosts, paths, port and protocol from its objects
+type SourceConfig struct {
+	Group   string `json:"group,omitempty"`
+	Version string `json:"version"`
+	Kind    string `json:"kind"`
+	// Resource is the plural name of the kind, used by the Helm chart to grant access to it
+	Resource string `json:"resource,omitempty"`
+
+	// Hosts yields the hosts to probe, or URLs whose scheme, port and path are used as well
+	Hosts Expression `json:"hosts"`
+	// Paths yields the paths to probe on every host, the root when unset or empty
+	Paths *Expression `json:"paths,omitempty"`
+	// Port yields the port to probe, the default one of the protocol when unset or empty
+	Port *Expression `json:"port,omitempty"`
+	// Protocol yields the protocol to probe, http when unset or empty
+	Protocol *Expression `json:"protocol,omitempty"`
+}
+
+// Expression extracts values from an object, with either a JSONPath template such as
+// {.spec.hosts[*]} or a CEL expression over the object variable
+type Expression struct {
+	JSONPath string `json:"jsonPath,omitempty"`
+	CEL      string `json:"cel,omitempty"`
+}
+
+// extractor returns the values an expression yields for an object
+type extractor func(obj map[string]interface{}) ([]string, error)
+
+// GVK returns the kind of the source
+func (s SourceConfig) GVK() schema.GroupVersionKind {
+	return schema.GroupVersionKind{Group: s.Group, Version: s.Version, Kind: s.Kind}
+}
+
+// OwnerKind is the kind recorded in the owner of the checks, qualified by the group so that
+// a Knative Service is not mistaken for a core one
+func (s SourceConfig) OwnerKind() string {
+	if s.Group == "" {
+		return s.Kind
+	}
+	return s.Kind + "." + s.Group
+}
+
+// Compile validates the source and returns the function building the checks of its objects
+func (s SourceConfig) Compile() (func(obj *unstructured.Unstructured) ([]IngressInfo, error), error) {
+	if s.Version == "" || s.Kind == "" {
+		return nil, errors.New("version and kind are required")
+	}
+	hosts, err := compileExpression("hosts", &s.Hosts)
+	if err != nil {
+		return nil, err
+	}
+	paths, err := compileExpression("paths", s.Paths)
+	if err != nil {
+		return nil, err
+	}
+	port, err := compileExpression("port", s.Port)
+	if err != nil {
+		return nil, err
+	}
+	protocol, err := compileExpression("protocol", s.Protocol)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(obj *unstructured.Unstructured) ([]IngressInfo, error) {
+		values := map[string][]string{}
+		for field, extract := range map[string]extractor{"hosts": hosts, "paths": paths, "port": port, "protocol": protocol} {
+			if extract == nil {
+				continue
+			}
+			result, err := extract(obj.Object)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", field, err)
+			}
+			values[field] = result
+		}
+
+		var targets []hostPath
+		for _, host := range values["hosts"] {
+			target := sourceTarget(host, first(values["protocol"]), first(values["port"]))
+			if len(values["paths"]) == 0 {
+				targets = append(targets, target)
+				continue
+			}
+			for _, path := range values["paths"] {
+				target.path = pathPrefix(path)
+				targets = append(targets, target)
+			}
+		}
+
+		checks, err := hostPathChecks(obj, targets, false)
+		if err != nil {
+			return nil, err
+		}
+		for i := range checks {
+			checks[i].Owner = OwnerKey(s.OwnerKind(), obj.GetNamespace(), obj.GetName())
+		}
+		return checks, nil
+	}, nil
+}
+
+// sourceTarget builds the target of a host or URL, the configured protocol and port taking
+// precedence over the ones of the URL
+func sourceTarget(host, protocol, port string) hostPath {
+	target := hostPath{host: host}
+	if u, err := url.Parse(host); err == nil && u.Scheme != "" && u.Host != "" {
+		target = hostPath{host: u.Hostname(), path: strings.TrimSuffix(u.Path, "/"), protocol: u.Scheme, port: u.Port()}
+	}
+	if protocol != "" {
+		target.protocol = strings.ToLower(protocol)
+	}
+	if port != "" {
+		target.port = port
+	}
+	if target.protocol == "" {
+		target.protocol = "http"
+	}
+	if target.port == "" {
+		target.port = "80"
+		if target.protocol == "https" {
+			target.port = "443"
+		}
+	}
+	return target
+}
+
+func first(values []string) string {
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+// compileExpression parses the expression of a field, nil when it is unset
+func compileExpression(field string, e *Expression) (extractor, error) {
+	switch {
+	case e == nil || (e.JSONPath == "" && e.CEL == "" && field != "hosts"):
+		return nil, nil
+	case e.JSONPath != "" && e.CEL != "":
+		return nil, fmt.Errorf("%s: set either jsonPath or cel", field)
+	case e.JSONPath != "":
+		extract, err := compileJSONPath(e.JSONPath)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", field, err)
+		}
+		return extract, nil
+	case e.CEL != "":
+		extract, err := compileCEL(e.CEL)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", field, err)
+		}
+		return extract, nil
+	}
+	return nil, fmt.Errorf("%s: jsonPath or cel is required", field)
+}
+
+func compileJSONPath(template string) (extractor, error) {
+	parser := jsonpath.New("source").AllowMissingKeys(true)
+	if err := parser.Parse(template); err != nil {
+		return nil, err
+	}
+	return func(obj map[string]interface{}) ([]string, error) {
+		results, err := parser.FindResults(obj)
+		if err != nil {
+			return nil, err
+		}
+		var values []string
+		for _, result := range results {
+			for _, value := range result {
+				values = appendValue(values, value.Interface())
+			}
+		}
+		return values, nil
+	}, nil
+}
+
+func compileCEL(expression string) (extractor, error) {
+	env, err := cel.NewEnv(cel.Variable("object", cel.DynType))
+	if err != nil {
+		return nil, err
+	}
+	ast, issues := env.Compile(expression)
+	if issues != nil && issues.Err() != nil {
+		return nil, issues.Err()
+	}
+	program, err := env.Program(ast)
+	if err != nil {
+		return nil, err
+	}
+	return func(obj map[string]interface{}) ([]string, error) {
+		value, _, err := program.Eval(map[string]interface{}{"object": obj})
+		if err != nil {
+			// A missing field yields nothing, like a JSONPath would
+			if celMissingKey(err) {
+				return nil, nil
+			}
+			return nil, err
+		}
+		return celValues(nil, value), nil
+	}, nil
+}
+
+// celValues appends the values of a CEL result, flattening lists
+func celValues(values []string, value ref.Val) []string {
+	if list, ok := value.(traits.Lister); ok {
+		for it := list.Iterator(); it.HasNext() == types.True; {
+			values = celValues(values, it.Next())
+		}
+		return values
+	}
+	return appendValue(values, value.Value())
+}
+
+// appendValue appends the string form of a value, flattening lists and skipping empty ones
+func appendValue(values []string, value interface{}) []string {
+	switch v := value.(type) {
+	case nil:
+		return values
+	case string:
+		if v == "" {
+			return values
+		}
+		return append(values, v)
+	case []interface{}:
+		for _, item := range v {
+			values = appendValue(values, item)
+		}
+		return values
+	}
+	if rv := reflect.ValueOf(value); rv.Kind() == reflect.Slice && rv.Type().Elem().Kind() != reflect.Uint8 {
+		for i := 0; i < rv.Len(); i++ {
+			values = appendValue(values, rv.Index(i).Interface())
+		}
+		return values
+	}
+	return append(values, fmt.Sprint(value))
+}
+
+// celMissingKey reports whether a CEL evaluation failed on reading a missing map key or field.
+// cel-go has no exported type for it, only the message of the *types.Err it returns.
+func celMissingKey(err error) bool {
+	var celErr *types.Err
+	return errors.As(err, &celErr) && strings.HasPrefix(celErr.Error(), "no such key")
+}
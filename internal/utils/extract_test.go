@@ -0,0 +1,110 @@
+package utils
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/google/cel-go/cel"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+var _ = Describe("Configured sources", func() {
+	knative := schema.GroupVersionKind{Group: "serving.knative.dev", Version: "v1", Kind: "Service"}
+
+	It("should derive the checks from the URL found by a JSONPath", func() {
+		source := SourceConfig{Group: knative.Group, Version: knative.Version, Kind: knative.Kind,
+			Hosts: Expression{JSONPath: "{.status.url}"}}
+		checks, err := source.Compile()
+		Expect(err).NotTo(HaveOccurred())
+
+		obj := newSource(knative, map[string]interface{}{})
+		obj.Object["status"] = map[string]interface{}{"url": "https://web.shop.example.com:8443/app"}
+		result, err := checks(obj)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result).To(HaveLen(1))
+		Expect(result[0].Owner).To(Equal("Service.serving.knative.dev/shop/web"))
+		Expect(result[0].Target).To(Equal("web.shop.example.com"))
+		Expect(result[0].Protocol).To(Equal("https"))
+		Expect(result[0].Port).To(Equal("8443"))
+		Expect(result[0].Path).To(Equal("/app"))
+
+		_, err = checks(newSource(knative, map[string]interface{}{}))
+		Expect(err).To(MatchError(ErrNoHost))
+	})
+
+	It("should combine hosts and paths found by CEL expressions", func() {
+		source := SourceConfig{Group: "getambassador.io", Version: "v3alpha1", Kind: "Mapping",
+			Hosts:    Expression{CEL: "[object.spec.hostname]"},
+			Paths:    &Expression{CEL: "object.spec.prefix"},
+			Protocol: &Expression{JSONPath: "{.spec.protocol}"},
+			Port:     &Expression{CEL: "has(object.spec.port) ? object.spec.port : ''"}}
+		checks, err := source.Compile()
+		Expect(err).NotTo(HaveOccurred())
+
+		result, err := checks(newSource(source.GVK(), map[string]interface{}{
+			"hostname": "api.example.com",
+			"prefix":   "/v1",
+			"protocol": "HTTPS",
+		}))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result).To(HaveLen(1))
+		Expect(result[0].Key).To(Equal("api.example.com/v1"))
+		Expect(result[0].Protocol).To(Equal("https"))
+		Expect(result[0].Port).To(Equal("443"))
+	})
+
+	It("should reject invalid sources", func() {
+		_, err := SourceConfig{Version: "v1", Kind: "Foo", Hosts: Expression{}}.Compile()
+		Expect(err).To(HaveOccurred())
+		_, err = SourceConfig{Version: "v1", Kind: "Foo", Hosts: Expression{CEL: "object.spec.("}}.Compile()
+		Expect(err).To(HaveOccurred())
+		_, err = SourceConfig{Version: "v1", Kind: "Foo", Hosts: Expression{JSONPath: "{.a}", CEL: "1"}}.Compile()
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should load the sources of the configuration file", func() {
+		path := filepath.Join(GinkgoT().TempDir(), "config.yaml")
+		Expect(os.WriteFile(path, []byte(`
+sources:
+- group: serving.knative.dev
+  version: v1
+  kind: Service
+  resource: services
+  hosts:
+    jsonPath: '{.status.url}'
+`), 0o600)).To(Succeed())
+
+		config, err := LoadConfig(path)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(config.Sources).To(HaveLen(1))
+		Expect(config.Sources[0].GVK()).To(Equal(knative))
+
+		Expect(os.WriteFile(path, []byte("sources:\n- kind: Foo\n  unknown: true\n"), 0o600)).To(Succeed())
+		_, err = LoadConfig(path)
+		Expect(err).To(HaveOccurred())
+	})
+})
+
+var _ = Describe("CEL missing keys", func() {
+	eval := func(expression string) error {
+		env, err := cel.NewEnv(cel.Variable("object", cel.DynType))
+		Expect(err).NotTo(HaveOccurred())
+		ast, issues := env.Compile(expression)
+		Expect(issues.Err()).NotTo(HaveOccurred())
+		program, err := env.Program(ast)
+		Expect(err).NotTo(HaveOccurred())
+		_, _, err = program.Eval(map[string]interface{}{"object": map[string]interface{}{"spec": map[string]interface{}{}}})
+		return err
+	}
+
+	It("should only match the CEL errors of missing fields", func() {
+		Expect(celMissingKey(eval("object.status.url"))).To(BeTrue())
+		Expect(celMissingKey(eval("object.spec['host']"))).To(BeTrue())
+		Expect(celMissingKey(eval("1 / (size(object.spec) - 0)"))).To(BeFalse())
+		Expect(celMissingKey(errors.New("no such key: status"))).To(BeFalse())
+	})
+})
@@ -2,12 +2,59 @@ package utils
 
 import (
 	"flag"
+	"time"
 )
 
 var AppURL string
 var AppToken string
+var StatusPollInterval time.Duration
+var OTLPEndpoint string
+var OTLPInsecure bool
+var APIRateLimit float64
+var APIBurst int
+var ClusterName string
+var CacheResyncInterval time.Duration
+var ForceResyncInterval time.Duration
+var DryRun bool
+var Adopt bool
+var AdoptMatch = MatchRule{"target", "method", "path"}
 
+// InitFlags registers the flags of the controller manager
 func InitFlags() {
-	flag.StringVar(&AppURL, "app-url", "https://app.wenti.dev", "The URL of the server")
-	flag.StringVar(&AppToken, "app-token", "toto", "The Token for the server")
+	BindClientFlags(flag.CommandLine)
+	flag.DurationVar(&StatusPollInterval, "status-poll-interval", 0,
+		"How often the live state of each health check is read back from the server. It relies on a field "+
+			"the API does not document yet, so it is disabled by default.")
+	flag.StringVar(&OTLPEndpoint, "otlp-endpoint", "",
+		"The host:port of an OTLP/gRPC collector to export traces to. Tracing is disabled when empty.")
+	flag.BoolVar(&OTLPInsecure, "otlp-insecure", false, "If set, traces are exported without TLS.")
+	flag.DurationVar(&CacheResyncInterval, "cache-resync-interval", 10*time.Minute,
+		"How often the in-memory index of health checks is refreshed from the server. Use 0 to only fill it at startup.")
+	flag.DurationVar(&ForceResyncInterval, "force-resync-interval", time.Hour,
+		"How often unchanged health checks are written again to the server. Use 0 to never force a write.")
+	flag.BoolVar(&DryRun, "dry-run", false,
+		"If set, the health checks to create, update and delete are only logged and reported, never written.")
+	flag.StringVar(&ConfigFile, "config", "",
+		"The path of the agent configuration file, declaring extra kinds to derive health checks from "+
+			"and the rules selecting the Ingresses to monitor.")
+	BindAdoptFlags(flag.CommandLine)
+}
+
+// BindAdoptFlags registers the flags controlling the adoption of existing checks
+func BindAdoptFlags(fs *flag.FlagSet) {
+	fs.BoolVar(&Adopt, "adopt", false,
+		"If set, an Ingress without a check of its own adopts the single unmanaged check matching --adopt-match.")
+	fs.Var(&AdoptMatch, "adopt-match",
+		"The comma separated settings an unmanaged check must share with an Ingress to be adopted, "+
+			"among target, path, method, protocol, port and name.")
+}
+
+// BindClientFlags registers the flags needed to talk to the server, shared by the subcommands
+func BindClientFlags(fs *flag.FlagSet) {
+	fs.StringVar(&AppURL, "app-url", "https://app.wenti.dev", "The URL of the server")
+	fs.StringVar(&AppToken, "app-token", "toto", "The Token for the server")
+	fs.Float64Var(&APIRateLimit, "api-rate-limit", 10, "The maximum number of requests per second sent to the server.")
+	fs.IntVar(&APIBurst, "api-burst", 20, "The maximum burst of requests sent to the server.")
+	fs.StringVar(&ClusterName, "cluster-name", "default",
+		"The name of this cluster, recorded on the health checks it owns.")
 }
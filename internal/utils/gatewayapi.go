@@ -0,0 +1,146 @@
+package utils
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// Gateway API kinds
+var (
+	GatewayGVK   = schema.GroupVersionKind{Group: "gateway.networking.k8s.io", Version: "v1", Kind: "Gateway"}
+	GRPCRouteGVK = schema.GroupVersionKind{Group: "gateway.networking.k8s.io", Version: "v1", Kind: "GRPCRoute"}
+	TLSRouteGVK  = schema.GroupVersionKind{Group: "gateway.networking.k8s.io", Version: "v1alpha2", Kind: "TLSRoute"}
+)
+
+// GatewayParent is a Gateway a route attaches to, optionally to a single listener
+type GatewayParent struct {
+	types.NamespacedName
+	SectionName string
+	Port        int64
+}
+
+// GatewayParents returns the Gateways a route attaches to, ignoring other parent kinds
+func GatewayParents(route *unstructured.Unstructured) []GatewayParent {
+	refs, _, _ := unstructured.NestedSlice(route.Object, "spec", "parentRefs")
+	parents := make([]GatewayParent, 0, len(refs))
+	for _, item := range refs {
+		ref, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		group, found, _ := unstructured.NestedString(ref, "group")
+		if found && group != GatewayGVK.Group {
+			continue
+		}
+		if kind, found, _ := unstructured.NestedString(ref, "kind"); found && kind != GatewayGVK.Kind {
+			continue
+		}
+		parent := GatewayParent{NamespacedName: types.NamespacedName{Namespace: route.GetNamespace()}}
+		parent.Name, _, _ = unstructured.NestedString(ref, "name")
+		if namespace, _, _ := unstructured.NestedString(ref, "namespace"); namespace != "" {
+			parent.Namespace = namespace
+		}
+		parent.SectionName, _, _ = unstructured.NestedString(ref, "sectionName")
+		parent.Port, _, _ = unstructured.NestedInt64(ref, "port")
+		if parent.Name != "" {
+			parents = append(parents, parent)
+		}
+	}
+	return parents
+}
+
+// GatewayRouteChecks builds one check per hostname of a GRPCRoute or TLSRoute, on the listeners
+// of its parent Gateways accepting it: grpc or grpcs on HTTP and HTTPS listeners for a GRPCRoute,
+// tls on TLS listeners for a TLSRoute. A route without hostnames takes the ones of the listeners.
+func GatewayRouteChecks(route *unstructured.Unstructured, gateways map[types.NamespacedName]*unstructured.Unstructured) ([]IngressInfo, error) {
+	hostnames, _, _ := unstructured.NestedStringSlice(route.Object, "spec", "hostnames")
+	listeners := map[string]gatewayListener{}
+	for _, parent := range GatewayParents(route) {
+		gateway, ok := gateways[parent.NamespacedName]
+		if !ok {
+			continue
+		}
+		items, _, _ := unstructured.NestedSlice(gateway.Object, "spec", "listeners")
+		for _, item := range items {
+			listener, ok := item.(map[string]interface{})
+			if !ok || !parentSelects(parent, listener) {
+				continue
+			}
+			protocol, ok := routeProtocol(route.GetKind(), listener)
+			if !ok {
+				continue
+			}
+			number, _, _ := unstructured.NestedInt64(listener, "port")
+			accepted := gatewayListener{protocol: protocol, port: strconv.FormatInt(number, 10)}
+
+			pattern, _, _ := unstructured.NestedString(listener, "hostname")
+			hosts := hostnames
+			if len(hosts) == 0 {
+				hosts = []string{pattern}
+			}
+			for _, host := range hosts {
+				if host == "" || strings.Contains(host, "*") || (pattern != "" && !hostMatches(pattern, host)) {
+					continue
+				}
+				// Prefer the listener serving TLS when several accept the host
+				if current, seen := listeners[host]; !seen || current.protocol == ProtocolGRPC {
+					listeners[host] = accepted
+				}
+			}
+		}
+	}
+
+	targets := make([]hostPath, 0, len(listeners))
+	for host, listener := range listeners {
+		targets = append(targets, hostPath{host: host, protocol: listener.protocol, port: listener.port})
+	}
+	sort.Slice(targets, func(i, j int) bool { return targets[i].host < targets[j].host })
+	return hostPathChecks(route, targets, false)
+}
+
+// parentSelects reports whether a parent reference covers a listener of its Gateway
+func parentSelects(parent GatewayParent, listener map[string]interface{}) bool {
+	if parent.SectionName != "" {
+		if name, _, _ := unstructured.NestedString(listener, "name"); name != parent.SectionName {
+			return false
+		}
+	}
+	if parent.Port != 0 {
+		if port, _, _ := unstructured.NestedInt64(listener, "port"); port != parent.Port {
+			return false
+		}
+	}
+	return true
+}
+
+// routeProtocol returns the check protocol of a route of the kind served by a listener, false
+// when the listener cannot serve it
+func routeProtocol(kind string, listener map[string]interface{}) (string, bool) {
+	protocol, _, _ := unstructured.NestedString(listener, "protocol")
+	switch {
+	case kind == GRPCRouteGVK.Kind && protocol == "HTTP":
+		return ProtocolGRPC, true
+	case kind == GRPCRouteGVK.Kind && protocol == "HTTPS":
+		return ProtocolGRPCS, true
+	case kind == TLSRouteGVK.Kind && protocol == "TLS":
+		return ProtocolTLS, true
+	}
+	return "", false
+}
+
+// hostMatches reports whether a host matches a hostname pattern, which may start with a *.
+// wildcard matching any subdomain
+func hostMatches(pattern, host string) bool {
+	switch {
+	case pattern == "*" || strings.EqualFold(pattern, host):
+		return true
+	case strings.HasPrefix(pattern, "*."):
+		return strings.HasSuffix(strings.ToLower(host), strings.ToLower(pattern[1:]))
+	}
+	return false
+}
@@ -0,0 +1,69 @@
+package utils
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+var _ = Describe("Gateway API checks", func() {
+	gatewayKey := types.NamespacedName{Namespace: "infra", Name: "public"}
+	newGateway := func(listeners ...interface{}) map[types.NamespacedName]*unstructured.Unstructured {
+		gateway := newSource(GatewayGVK, map[string]interface{}{"listeners": listeners})
+		gateway.SetNamespace(gatewayKey.Namespace)
+		gateway.SetName(gatewayKey.Name)
+		return map[types.NamespacedName]*unstructured.Unstructured{gatewayKey: gateway}
+	}
+	listener := func(name, protocol string, port int64, hostname string) interface{} {
+		listener := map[string]interface{}{"name": name, "protocol": protocol, "port": port}
+		if hostname != "" {
+			listener["hostname"] = hostname
+		}
+		return listener
+	}
+	parentRef := map[string]interface{}{"name": "public", "namespace": "infra"}
+
+	It("should probe a grpc route over TLS when a listener terminates it", func() {
+		route := newSource(GRPCRouteGVK, map[string]interface{}{
+			"parentRefs": []interface{}{parentRef},
+			"hostnames":  []interface{}{"api.example.com", "*.example.com"},
+		})
+		gateways := newGateway(
+			listener("http", "HTTP", 80, ""),
+			listener("https", "HTTPS", 443, "*.example.com"),
+		)
+
+		checks, err := GatewayRouteChecks(route, gateways)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(checks).To(HaveLen(1))
+		Expect(checks[0].Owner).To(Equal("GRPCRoute/shop/web"))
+		Expect(checks[0].Target).To(Equal("api.example.com"))
+		Expect(checks[0].Protocol).To(Equal(ProtocolGRPCS))
+		Expect(checks[0].Port).To(Equal("443"))
+		Expect(checks[0].Path).To(BeEmpty())
+		Expect(checks[0].Method).To(BeEmpty())
+		Expect(ValidateIngressInfo(checks[0])).To(BeEmpty())
+	})
+
+	It("should probe a tls route on the listener it attaches to", func() {
+		route := newSource(TLSRouteGVK, map[string]interface{}{
+			"parentRefs": []interface{}{map[string]interface{}{"name": "public", "namespace": "infra", "sectionName": "db"}},
+		})
+		gateways := newGateway(
+			listener("tls", "TLS", 443, "tls.example.com"),
+			listener("db", "TLS", 5432, "db.example.com"),
+		)
+
+		checks, err := GatewayRouteChecks(route, gateways)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(checks).To(HaveLen(1))
+		Expect(checks[0].Target).To(Equal("db.example.com"))
+		Expect(checks[0].Protocol).To(Equal(ProtocolTLS))
+		Expect(checks[0].Port).To(Equal("5432"))
+
+		_, err = GatewayRouteChecks(route, nil)
+		Expect(err).To(MatchError(ErrNoHost))
+	})
+})
@@ -3,11 +3,23 @@ package utils
 import (
 	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
+	"github.com/wentidev/agent/internal/metrics"
+	"github.com/wentidev/agent/internal/tracing"
 	clientsdk "github.com/wentidev/sdk-go"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
 	networkingv1 "k8s.io/api/networking/v1"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 )
@@ -19,6 +31,16 @@ var HealthCheckHTTPCode string = "wenti.dev/health-check-success-codes"
 var HealthCheckTimeout string = "wenti.dev/health-check-timeout"
 var HealthCheckInterval string = "wenti.dev/health-check-interval"
 var HealthCheckPort string = "wenti.dev/health-check-port"
+var ScaledDown string = "wenti.dev/scaled-down"
+var HealthCheckStatus string = "wenti.dev/status"
+
+// Live states of a health check as reflected on the cluster
+const (
+	CheckStatusUp       = "up"
+	CheckStatusDown     = "down"
+	CheckStatusUnknown  = "unknown"
+	CheckStatusDisabled = "disabled"
+)
 
 type HealthCheck struct {
 	Count      int `json:"count"`
@@ -60,80 +82,230 @@ func HeaderInterceptor(ctx context.Context, req *http.Request) error {
 	return nil
 }
 
+// TraceInterceptor propagates the trace context of the request to the server
+func TraceInterceptor(ctx context.Context, req *http.Request) error {
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+	return nil
+}
+
+var (
+	clientMu     sync.Mutex
+	sharedClient *clientsdk.ClientWithResponses
+)
+
+// CreateClient returns the client shared by every call to the server, so that they
+// all go through the same rate limiter
 func CreateClient() (*clientsdk.ClientWithResponses, error) {
-	client, err := clientsdk.NewClientWithResponses(AppURL, clientsdk.WithRequestEditorFn(HeaderInterceptor))
+	clientMu.Lock()
+	defer clientMu.Unlock()
+	if sharedClient != nil {
+		return sharedClient, nil
+	}
+
+	client, err := clientsdk.NewClientWithResponses(AppURL,
+		clientsdk.WithRequestEditorFn(RateLimitInterceptor),
+		clientsdk.WithRequestEditorFn(HeaderInterceptor),
+		clientsdk.WithRequestEditorFn(TraceInterceptor),
+	)
 	if err != nil {
 		log.Log.Error(err, "unable to create client")
 		return nil, err
 	}
+	sharedClient = client
 	return client, nil
 }
 
-func FindHealthCheck(resource IngressInfo) (bool, string) {
-	client, err := CreateClient()
+// startAPICall opens a client span for a Wenti API operation
+func startAPICall(ctx context.Context, operation string) (context.Context, trace.Span, time.Time) {
+	ctx, span := tracing.Tracer().Start(ctx, "wenti."+operation, trace.WithSpanKind(trace.SpanKindClient))
+	return ctx, span, time.Now()
+}
+
+// endAPICall records the metrics and span attributes of a Wenti API call
+func endAPICall(span trace.Span, operation string, start time.Time, resp *http.Response, err error) {
+	if err != nil || resp == nil {
+		metrics.ObserveAPICall(operation, 0, start)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "request failed")
+		return
+	}
+
+	metrics.ObserveAPICall(operation, resp.StatusCode, start)
+	span.SetAttributes(semconv.HTTPResponseStatusCode(resp.StatusCode))
+	if resp.Request != nil {
+		span.SetAttributes(
+			semconv.HTTPRequestMethodKey.String(resp.Request.Method),
+			semconv.URLFull(resp.Request.URL.String()),
+		)
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		span.SetStatus(codes.Error, resp.Status)
+	}
+}
+
+func FindHealthCheck(ctx context.Context, resource IngressInfo) (bool, string, error) {
+	if err := Checks.EnsureSynced(ctx); err != nil {
+		log.Log.Error(err, "(find) unable to list health checks")
+		return false, "", err
+	}
+	check, ok, err := Checks.Find(resource)
 	if err != nil {
-		log.Log.Error(err, "(find) unable to create client")
-		return false, ""
+		return false, "", err
 	}
-	params := &clientsdk.GetApiV1HealthchecksParams{
-		Target: &resource.Target,
-		Method: &resource.Method,
-		Path:   &resource.Path,
+	if ok {
+		log.Log.Info("(find) health check found", "Name", check.Name)
 	}
+	return ok, check.ID, nil
+}
 
-	resp, err := client.GetApiV1HealthchecksWithResponse(context.Background(), params)
+// ListHealthChecks returns every check of the account. The endpoint is not paginated,
+// all the checks are returned in a single response.
+func ListHealthChecks(ctx context.Context) ([]RemoteCheck, error) {
+	client, err := CreateClient()
 	if err != nil {
-		log.Log.Error(err, "(find) unable to retrieve health checks")
-		return false, ""
+		log.Log.Error(err, "(list) unable to create client")
+		return nil, err
 	}
-	if resp.HTTPResponse.StatusCode != http.StatusOK {
-		log.Log.Error(err, "(find) statusCode or Content-Type is not valid")
-		return false, ""
+
+	ctx, span, start := startAPICall(ctx, "list")
+	defer span.End()
+	resp, err := client.GetApiV1HealthchecksWithResponse(ctx, &clientsdk.GetApiV1HealthchecksParams{})
+	if err != nil {
+		endAPICall(span, "list", start, nil, err)
+		log.Log.Error(err, "(list) unable to retrieve health checks")
+		return nil, err
+	}
+	endAPICall(span, "list", start, resp.HTTPResponse, nil)
+	if resp.HTTPResponse.StatusCode != http.StatusOK || resp.JSON200 == nil {
+		err := fmt.Errorf("unexpected status code %d", resp.HTTPResponse.StatusCode)
+		log.Log.Error(err, "(list) statusCode or Content-Type is not valid")
+		return nil, err
+	}
+	if resp.JSON200.HttpChecks == nil {
+		return nil, nil
 	}
 
-	if resp.JSON200 == nil {
-		log.Log.Error(err, "(find) JSON200 is nil")
-		return false, ""
+	checks := make([]RemoteCheck, 0, len(*resp.JSON200.HttpChecks))
+	for _, item := range *resp.JSON200.HttpChecks {
+		if item.Id == nil {
+			continue
+		}
+		checks = append(checks, RemoteCheck{
+			ID:          *item.Id,
+			Name:        stringValue(item.Name),
+			Description: stringValue(item.Description),
+			Target:      stringValue(item.Target),
+			Port:        intValue(item.Port),
+			Protocol:    stringValue(item.Protocol),
+			Path:        stringValue(item.Path),
+			Method:      stringValue(item.Method),
+			Timeout:     intValue(item.Timeout),
+			Interval:    intValue(item.Interval),
+			HTTPCode:    statusValue(item.ValidStatus),
+			Labels:      parseLabels(item.Labels),
+		})
 	}
+	return checks, nil
+}
 
-	log.Log.Info("(find) health check response", "body", resp.JSON200.HttpChecks)
-	log.Log.Info("(find) health check response", "count", resp.JSON200.Count)
+func statusValue(i *int) string {
+	if i == nil || *i == 0 {
+		return ""
+	}
+	return strconv.Itoa(*i)
+}
 
-	if *resp.JSON200.Count != 0 {
-		checks := *resp.JSON200.HttpChecks
-		log.Log.Info("(find) health check found", "Name", *checks[0].Name)
-		return true, *checks[0].Id
+func stringValue(s *string) string {
+	if s == nil {
+		return ""
 	}
+	return *s
+}
 
-	return false, ""
+func intValue(i *int) int {
+	if i == nil {
+		return 0
+	}
+	return *i
 }
 
-func DeleteHealthCheck(resource IngressInfo) (string, error) {
-	findBool, healthCheckID := FindHealthCheck(resource)
+// cachedCheck is the remote check written with the spec
+func cachedCheck(id string, spec clientsdk.PutApiV1HealthchecksIdJSONRequestBody) RemoteCheck {
+	labels := map[string]string{}
+	if spec.Labels != nil {
+		for key, value := range *spec.Labels {
+			if s, ok := value.(string); ok {
+				labels[key] = s
+			}
+		}
+	}
+	return RemoteCheck{
+		ID:          id,
+		Name:        spec.Name,
+		Description: spec.Description,
+		Target:      spec.Target,
+		Port:        spec.Port,
+		Protocol:    spec.Protocol,
+		Path:        spec.Path,
+		Method:      spec.Method,
+		Timeout:     spec.Timeout,
+		Interval:    spec.Interval,
+		HTTPCode:    spec.HttpCode,
+		Labels:      labels,
+	}
+}
+
+func DeleteHealthCheck(ctx context.Context, resource IngressInfo) (string, error) {
+	defer LockTarget(resource)()
+	findBool, healthCheckID, err := FindHealthCheck(ctx, resource)
+	if err != nil {
+		return "", err
+	}
 	if !findBool {
 		log.Log.Info("health check does not exist for bool")
 		return "", nil
 	}
 	log.Log.Info("health check exists with ID", "HealthCheckID", healthCheckID)
-	err := wentiApiDeleteHealthCheck(healthCheckID)
+	if DryRun {
+		return dryRun("delete", resource), nil
+	}
+	err = wentiApiDeleteHealthCheck(ctx, healthCheckID)
 	if err != nil {
 		return "", err
 	}
 	return "deleted", nil
 }
 
-func CreateOrUpdateHealthCheck(resource IngressInfo) (string, error) {
-	findBool, healthCheckID := FindHealthCheck(resource)
+func CreateOrUpdateHealthCheck(ctx context.Context, resource IngressInfo) (string, error) {
+	defer LockTarget(resource)()
+	spec, hash, err := DesiredSpec(resource)
+	if err != nil {
+		log.Log.Error(err, "unable to build health check spec")
+		return "", err
+	}
+	findBool, healthCheckID, err := FindHealthCheck(ctx, resource)
+	if err != nil {
+		return "", err
+	}
 
 	if findBool {
-		status, err := wentiApiUpdateHealthCheck(resource, healthCheckID)
+		if upToDate(healthCheckID, hash) {
+			return "unchanged", nil
+		}
+		if DryRun {
+			return dryRun("update", resource), nil
+		}
+		status, err := wentiApiUpdateHealthCheck(ctx, spec, healthCheckID)
 		if err != nil {
 			return "", err
 		}
 		return status, nil
 	}
 	log.Log.Info("health check does not exist, creating it")
-	status, err := wentiApiCreateHealthCheck(resource)
+	if DryRun {
+		return dryRun("create", resource), nil
+	}
+	status, err := wentiApiCreateHealthCheck(ctx, spec)
 	if err != nil {
 		return "", err
 	}
@@ -141,152 +313,212 @@ func CreateOrUpdateHealthCheck(resource IngressInfo) (string, error) {
 
 }
 
-func wentiApiDeleteHealthCheck(HealthCheckId string) error {
-	client, err := CreateClient()
+// AdoptHealthCheck takes over an existing check for the resource by writing its spec and
+// ownership labels
+func AdoptHealthCheck(ctx context.Context, id string, resource IngressInfo) (string, error) {
+	defer LockTarget(resource)()
+	spec, _, err := DesiredSpec(resource)
 	if err != nil {
-		log.Log.Error(err, "(delete) unable to update client")
-		return err
+		log.Log.Error(err, "unable to build health check spec")
+		return "", err
 	}
-	resp, err := client.DeleteApiV1HealthchecksIdWithResponse(context.Background(), HealthCheckId)
-	if err != nil {
-		log.Log.Error(err, "(delete) error in API")
-		return err
+	if DryRun {
+		return dryRun("adopt", resource), nil
 	}
+	return wentiApiUpdateHealthCheck(ctx, spec, id)
+}
 
-	if resp.HTTPResponse.StatusCode != http.StatusNoContent {
-		log.Log.Error(err, "(delete) statusCode or Content-Type is not valid")
-		body := bytes.NewReader(resp.Body)
-		data, err := io.ReadAll(body)
-		if err != nil {
-			log.Log.Error(err, "unable to read response body")
-			return err
-		}
-		log.Log.Info("delete", "data", string(data))
-		log.Log.Error(err, "(delete) statusCode or Content-Type is not valid")
-		return err
+// DeleteHealthCheckByID deletes the check, whoever owns it
+func DeleteHealthCheckByID(ctx context.Context, check RemoteCheck) (string, error) {
+	if DryRun {
+		return dryRun("delete", IngressInfo{Name: check.Name, Target: check.Target}), nil
 	}
-	return nil
+	if err := wentiApiDeleteHealthCheck(ctx, check.ID); err != nil {
+		return "", err
+	}
+	return "deleted", nil
 }
 
-func wentiApiCreateHealthCheck(resource IngressInfo) (string, error) {
-	client, err := CreateClient()
-	if err != nil {
-		log.Log.Error(err, "(create) unable to update client")
-		return "", err
+// DisableHealthCheck writes the check back with probing disabled, keeping the settings
+// returned by the server
+func DisableHealthCheck(ctx context.Context, check RemoteCheck) (string, error) {
+	labels := map[string]interface{}{}
+	for key, value := range check.Labels {
+		labels[key] = value
+	}
+	delete(labels, SpecHashLabel)
+	spec := clientsdk.PutApiV1HealthchecksIdJSONRequestBody{
+		Description: check.Description,
+		Enabled:     false,
+		HttpCode:    check.HTTPCode,
+		Interval:    check.Interval,
+		Labels:      &labels,
+		Method:      check.Method,
+		Name:        check.Name,
+		Path:        check.Path,
+		Port:        check.Port,
+		Protocol:    check.Protocol,
+		Target:      check.Target,
+		Timeout:     check.Timeout,
+	}
+	if spec.HttpCode == "" {
+		spec.HttpCode = NewIngressInfo().HTTPCode
+	}
+	if DryRun {
+		return dryRun("disable", IngressInfo{Name: check.Name, Target: check.Target}), nil
 	}
+	return wentiApiUpdateHealthCheck(ctx, spec, check.ID)
+}
+
+// dryRun logs and counts a write skipped in dry-run mode, and returns the result to report
+func dryRun(operation string, resource IngressInfo) string {
+	log.Log.Info("dry run, skipping write", "operation", operation, "name", resource.Name, "target", resource.Target)
+	metrics.DryRunOperations.WithLabelValues(operation).Inc()
+	return "would " + operation
+}
+
+// ErrStatusUnsupported is returned when the server does not report the state of its checks
+var ErrStatusUnsupported = errors.New("health check status not reported by the server")
 
-	// Convert for interval
-	interval, err := ConvertStringToInt(resource.Interval)
+// GetHealthCheckStatus returns the live state of the health check matching the resource
+func GetHealthCheckStatus(ctx context.Context, resource IngressInfo) (string, error) {
+	findBool, healthCheckID, err := FindHealthCheck(ctx, resource)
 	if err != nil {
-		log.Log.Error(err, "(create) unable to convert string to int")
 		return "", err
 	}
+	if !findBool {
+		return CheckStatusUnknown, nil
+	}
+	return wentiApiGetHealthCheckStatus(ctx, healthCheckID)
+}
 
-	// Convert for timeout
-	timeout, err := ConvertStringToInt(resource.Timeout)
+func wentiApiGetHealthCheckStatus(ctx context.Context, HealthCheckID string) (string, error) {
+	client, err := CreateClient()
 	if err != nil {
-		log.Log.Error(err, "(create) unable to convert string to int")
+		log.Log.Error(err, "(status) unable to create client")
 		return "", err
 	}
-
-	// Convert for port
-	port, err := ConvertStringToInt(resource.Port)
+	ctx, span, start := startAPICall(ctx, "status")
+	defer span.End()
+	resp, err := client.GetApiV1HealthchecksIdWithResponse(ctx, HealthCheckID)
 	if err != nil {
-		log.Log.Error(err, "(create) unable to convert string to int")
+		endAPICall(span, "status", start, nil, err)
+		log.Log.Error(err, "(status) unable to retrieve health check")
 		return "", err
 	}
-	resp, err := client.PostApiV1HealthchecksWithResponse(context.Background(), clientsdk.PostApiV1HealthchecksJSONRequestBody{
-		Description: resource.Description,
-		Enabled:     true,
-		HttpCode:    resource.HTTPCode,
-		Interval:    interval,
-		Method:      resource.Method,
-		Name:        resource.Name,
-		Path:        resource.Path,
-		Port:        port,
-		Protocol:    resource.Protocol,
-		Target:      resource.Target,
-		Timeout:     timeout,
-	})
-	if err != nil {
-		log.Log.Error(err, "(create) unable to retrieve health checks")
+	endAPICall(span, "status", start, resp.HTTPResponse, nil)
+	if resp.HTTPResponse.StatusCode != http.StatusOK {
+		err := fmt.Errorf("unexpected status code %d", resp.HTTPResponse.StatusCode)
+		log.Log.Error(err, "(status) statusCode or Content-Type is not valid")
 		return "", err
 	}
 
-	if resp.HTTPResponse.StatusCode != http.StatusCreated {
-		log.Log.Info("create", "statusCode", resp.HTTPResponse.StatusCode)
-		log.Log.Info("create", "headers", resp.HTTPResponse.Header.Get("Content-Type"))
-		body := bytes.NewReader(resp.Body)
-		data, err := io.ReadAll(body)
-		if err != nil {
-			log.Log.Error(err, "unable to read response body")
-			return "", err
-		}
-		log.Log.Info("create", "data", string(data))
-		log.Log.Error(err, "(create) statusCode or Content-Type is not valid")
+	// The generated SDK does not model the check state yet, read it from the raw body
+	var body struct {
+		Status *string `json:"status"`
+	}
+	if err := json.Unmarshal(resp.Body, &body); err != nil {
+		log.Log.Error(err, "(status) unable to decode response body")
 		return "", err
 	}
-	return "created", nil
+	if body.Status == nil {
+		return "", ErrStatusUnsupported
+	}
+
+	switch strings.ToLower(*body.Status) {
+	case CheckStatusUp:
+		return CheckStatusUp, nil
+	case CheckStatusDown:
+		return CheckStatusDown, nil
+	default:
+		return CheckStatusUnknown, nil
+	}
+}
+
+// unexpectedStatus is the error of a call the server answered with an unexpected status code
+func unexpectedStatus(resp *http.Response, body []byte) error {
+	return fmt.Errorf("unexpected status code %d: %s", resp.StatusCode, bytes.TrimSpace(body))
 }
 
-func wentiApiUpdateHealthCheck(resource IngressInfo, HealthCheckID string) (string, error) {
+func wentiApiDeleteHealthCheck(ctx context.Context, HealthCheckId string) error {
 	client, err := CreateClient()
 	if err != nil {
-		log.Log.Error(err, "(update) unable to update client")
-		return "", err
+		log.Log.Error(err, "(delete) unable to update client")
+		return err
 	}
+	ctx, span, start := startAPICall(ctx, "delete")
+	defer span.End()
+	resp, err := client.DeleteApiV1HealthchecksIdWithResponse(ctx, HealthCheckId)
+	if err != nil {
+		endAPICall(span, "delete", start, nil, err)
+		log.Log.Error(err, "(delete) error in API")
+		return err
+	}
+	endAPICall(span, "delete", start, resp.HTTPResponse, nil)
+
+	// A check already deleted on the server is as good as deleted
+	if code := resp.HTTPResponse.StatusCode; code != http.StatusNoContent && code != http.StatusNotFound {
+		err := unexpectedStatus(resp.HTTPResponse, resp.Body)
+		log.Log.Error(err, "(delete) statusCode or Content-Type is not valid")
+		return err
+	}
+	Checks.Delete(HealthCheckId)
+	return nil
+}
 
-	// Convert for interval
-	interval, err := ConvertStringToInt(resource.Interval)
+func wentiApiCreateHealthCheck(ctx context.Context, spec clientsdk.PutApiV1HealthchecksIdJSONRequestBody) (string, error) {
+	client, err := CreateClient()
 	if err != nil {
-		log.Log.Error(err, "(update) unable to convert string to int")
+		log.Log.Error(err, "(create) unable to update client")
 		return "", err
 	}
 
-	// Convert for timeout
-	timeout, err := ConvertStringToInt(resource.Timeout)
+	ctx, span, start := startAPICall(ctx, "create")
+	defer span.End()
+	resp, err := client.PostApiV1HealthchecksWithResponse(ctx, clientsdk.PostApiV1HealthchecksJSONRequestBody(spec))
 	if err != nil {
-		log.Log.Error(err, "(update) unable to convert string to int")
+		endAPICall(span, "create", start, nil, err)
+		log.Log.Error(err, "(create) unable to retrieve health checks")
+		return "", err
+	}
+	endAPICall(span, "create", start, resp.HTTPResponse, nil)
+
+	if resp.HTTPResponse.StatusCode != http.StatusCreated {
+		err := unexpectedStatus(resp.HTTPResponse, resp.Body)
+		log.Log.Error(err, "(create) statusCode or Content-Type is not valid")
 		return "", err
 	}
+	if resp.JSON201 != nil && resp.JSON201.Id != nil {
+		Checks.Put(cachedCheck(*resp.JSON201.Id, spec))
+		lastWrites.Store(*resp.JSON201.Id, time.Now())
+	}
+	return "created", nil
+}
 
-	// Convert for port
-	port, err := ConvertStringToInt(resource.Port)
+func wentiApiUpdateHealthCheck(ctx context.Context, spec clientsdk.PutApiV1HealthchecksIdJSONRequestBody, HealthCheckID string) (string, error) {
+	client, err := CreateClient()
 	if err != nil {
-		log.Log.Error(err, "(update) unable to convert string to int")
+		log.Log.Error(err, "(update) unable to update client")
 		return "", err
 	}
 
-	resp, err := client.PutApiV1HealthchecksIdWithResponse(context.Background(), HealthCheckID, clientsdk.PutApiV1HealthchecksIdJSONRequestBody{
-		Description: resource.Description,
-		Enabled:     true,
-		HttpCode:    resource.HTTPCode,
-		Interval:    interval,
-		Method:      resource.Method,
-		Name:        resource.Name,
-		Path:        resource.Path,
-		Port:        port,
-		Protocol:    resource.Protocol,
-		Target:      resource.Target,
-		Timeout:     timeout,
-	})
+	ctx, span, start := startAPICall(ctx, "update")
+	defer span.End()
+	resp, err := client.PutApiV1HealthchecksIdWithResponse(ctx, HealthCheckID, spec)
 	if err != nil {
+		endAPICall(span, "update", start, nil, err)
 		log.Log.Error(err, "(update) unable to retrieve health checks")
 		return "", err
 	}
+	endAPICall(span, "update", start, resp.HTTPResponse, nil)
 
 	if resp.HTTPResponse.StatusCode != http.StatusNoContent {
-		body := bytes.NewReader(resp.Body)
-		data, err := io.ReadAll(body)
-		if err != nil {
-			log.Log.Error(err, "unable to read response body")
-			return "", err
-		}
-		log.Log.Info("update", "data", string(data))
-		log.Log.Info("update", "statusCode", resp.HTTPResponse.StatusCode)
+		err := unexpectedStatus(resp.HTTPResponse, resp.Body)
 		log.Log.Error(err, "(update) statusCode or Content-Type is not valid")
 		return "", err
 	}
+	Checks.Put(cachedCheck(HealthCheckID, spec))
+	lastWrites.Store(HealthCheckID, time.Now())
 
 	return "updated", nil
 }
@@ -0,0 +1,125 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// fakeAPI points the client at a server answering with handler, and gives every test a
+// fresh client and check cache
+func fakeAPI(handler http.HandlerFunc) {
+	server := httptest.NewServer(handler)
+	url, client, checks := AppURL, sharedClient, Checks
+	AppURL, sharedClient, Checks = server.URL, nil, NewCheckCache()
+	DeferCleanup(func() {
+		server.Close()
+		AppURL, sharedClient, Checks = url, client, checks
+	})
+}
+
+// writeJSON answers a request of the fake API
+func writeJSON(w http.ResponseWriter, code int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+// listedCheck is a check as listed by the API, owned by owner
+func listedCheck(id, owner string) map[string]interface{} {
+	labels, _ := json.Marshal(map[string]string{
+		ManagedByLabel: ManagedByValue, ClusterLabel: ClusterName, OwnerLabel: owner,
+	})
+	return map[string]interface{}{"id": id, "target": "shop.example.com", "method": "GET", "path": "/",
+		"labels": string(labels)}
+}
+
+var _ = Describe("Health check status", func() {
+	owner := OwnerKey("Ingress", "shop", "web")
+
+	It("should read the live state of the check of the resource", func() {
+		fakeAPI(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/api/v1/healthchecks":
+				writeJSON(w, http.StatusOK, map[string]interface{}{"http-checks": []interface{}{listedCheck("1", owner)}})
+			case "/api/v1/healthchecks/1":
+				writeJSON(w, http.StatusOK, map[string]string{"id": "1", "status": "DOWN"})
+			default:
+				w.WriteHeader(http.StatusNotFound)
+			}
+		})
+
+		status, err := GetHealthCheckStatus(context.Background(), IngressInfo{Owner: owner})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(status).To(Equal(CheckStatusDown))
+
+		status, err = GetHealthCheckStatus(context.Background(), IngressInfo{Owner: OwnerKey("Ingress", "shop", "api")})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(status).To(Equal(CheckStatusUnknown))
+	})
+
+	It("should report a server which does not return the state of its checks", func() {
+		fakeAPI(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/api/v1/healthchecks":
+				writeJSON(w, http.StatusOK, map[string]interface{}{"http-checks": []interface{}{listedCheck("1", owner)}})
+			default:
+				writeJSON(w, http.StatusOK, map[string]string{"id": "1"})
+			}
+		})
+
+		_, err := GetHealthCheckStatus(context.Background(), IngressInfo{Owner: owner})
+		Expect(err).To(MatchError(ErrStatusUnsupported))
+	})
+
+	It("should fail on server errors", func() {
+		fakeAPI(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/api/v1/healthchecks" {
+				writeJSON(w, http.StatusOK, map[string]interface{}{"http-checks": []interface{}{listedCheck("1", owner)}})
+				return
+			}
+			w.WriteHeader(http.StatusInternalServerError)
+		})
+
+		_, err := GetHealthCheckStatus(context.Background(), IngressInfo{Owner: owner})
+		Expect(err).To(MatchError(ContainSubstring("unexpected status code 500")))
+	})
+})
+
+var _ = Describe("Health check writes", func() {
+	answer := func(code int) {
+		fakeAPI(func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, code, map[string]string{"error": http.StatusText(code)})
+		})
+	}
+	check := RemoteCheck{ID: "1", Name: "shop_web", Target: "shop.example.com"}
+
+	It("should report the writes the server rejects", func() {
+		answer(http.StatusBadRequest)
+		_, err := DisableHealthCheck(context.Background(), check)
+		Expect(err).To(MatchError(ContainSubstring("unexpected status code 400")))
+		spec, _, err := DesiredSpec(NewIngressInfo())
+		Expect(err).NotTo(HaveOccurred())
+		_, err = wentiApiCreateHealthCheck(context.Background(), spec)
+		Expect(err).To(MatchError(ContainSubstring("unexpected status code 400")))
+
+		answer(http.StatusInternalServerError)
+		Checks.Put(check)
+		_, err = DeleteHealthCheckByID(context.Background(), check)
+		Expect(err).To(HaveOccurred())
+		_, found := Checks.Get(check.ID)
+		Expect(found).To(BeTrue())
+	})
+
+	It("should consider checks missing on the server as deleted", func() {
+		answer(http.StatusNotFound)
+		Checks.Put(check)
+		Expect(DeleteHealthCheckByID(context.Background(), check)).To(Equal("deleted"))
+		_, found := Checks.Get(check.ID)
+		Expect(found).To(BeFalse())
+	})
+})
@@ -0,0 +1,94 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+
+	monitoringv1alpha1 "github.com/wentidev/agent/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+)
+
+// ErrNoHost is returned for Ingresses without a host to monitor
+var ErrNoHost = errors.New("ingress has no host")
+
+// IngressInfoFromIngress builds the health check of an ingress from its first host,
+// the defaults and the wenti.dev/health-check-* annotations
+func IngressInfoFromIngress(ingress *networkingv1.Ingress) (IngressInfo, error) {
+	return IngressInfoWithSettings(ingress, IngressSettings{})
+}
+
+// IngressInfoWithRules builds the health check of an ingress like IngressInfoFromIngress, with
+// the settings the rules compute for it in its namespace applied before its annotations. It
+// returns ErrNotMonitored when a rule opts the ingress out.
+func IngressInfoWithRules(ingress *networkingv1.Ingress, namespace *corev1.Namespace, rules RuleSet) (IngressInfo, error) {
+	return IngressInfoWithSettings(ingress, IngressSettings{Namespace: namespace, Rules: rules})
+}
+
+// IngressSettings are applied to the check of an ingress before its annotations, in order
+type IngressSettings struct {
+	// Namespace of the ingress, read by the rules
+	Namespace *corev1.Namespace
+	Rules     RuleSet
+	// Template is the spec of the HealthCheckTemplate the ingress references, if any
+	Template *monitoringv1alpha1.HealthCheckTemplateSpec
+}
+
+// IngressInfoWithSettings builds the health check of an ingress like IngressInfoFromIngress,
+// with the settings the rules compute and its template applied before its annotations. It
+// returns ErrNotMonitored when a rule opts the ingress out.
+func IngressInfoWithSettings(ingress *networkingv1.Ingress, settings IngressSettings) (IngressInfo, error) {
+	if len(ingress.Spec.Rules) == 0 || ingress.Spec.Rules[0].Host == "" {
+		return IngressInfo{}, ErrNoHost
+	}
+
+	ingressInfo := NewIngressInfo()
+	ingressInfo.Name = fmt.Sprintf("%s_%s", ingress.Namespace, ingress.Name)
+	ingressInfo.Owner = OwnerKey("Ingress", ingress.Namespace, ingress.Name)
+	ingressInfo.Description = fmt.Sprintf("%s_%s", ingress.Namespace, ingress.Name)
+	ingressInfo.Target = ingress.Spec.Rules[0].Host
+	ingressInfo.ID = GetStringAnnotation(ingress, HealthCheckID)
+	if len(settings.Rules) > 0 {
+		input, err := RuleInput(ingress, settings.Namespace)
+		if err != nil {
+			return IngressInfo{}, err
+		}
+		monitored, err := settings.Rules.Apply(&ingressInfo, input)
+		if err != nil {
+			return IngressInfo{}, err
+		}
+		if !monitored {
+			return IngressInfo{}, ErrNotMonitored
+		}
+	}
+	if settings.Template != nil {
+		ApplyTemplate(&ingressInfo, *settings.Template)
+	}
+	if value := ingress.Annotations[HealthCheckPort]; value != "" {
+		ingressInfo.Port = value
+	}
+	ApplyAnnotations(&ingressInfo, ingress.Annotations)
+	if err := applyNames(&ingressInfo, ingress); err != nil {
+		return IngressInfo{}, err
+	}
+	return ingressInfo, nil
+}
+
+// ApplyAnnotations overrides the settings of the check with the wenti.dev/health-check-*
+// annotations, except the port which depends on the kind of resource
+func ApplyAnnotations(resource *IngressInfo, annotations map[string]string) {
+	overrides := map[string]*string{
+		HealthCheckProtocol: &resource.Protocol,
+		HealthCheckPath:     &resource.Path,
+		HealthCheckMethod:   &resource.Method,
+		HealthCheckHTTPCode: &resource.HTTPCode,
+		HealthCheckTimeout:  &resource.Timeout,
+		HealthCheckInterval: &resource.Interval,
+	}
+	for annotation, setting := range overrides {
+		if value := annotations[annotation]; value != "" {
+			*setting = value
+		}
+	}
+	applyProtocol(resource, annotations)
+}
@@ -0,0 +1,199 @@
+package utils
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// Istio kinds, read through the v1beta1 API served by every supported Istio release
+var (
+	VirtualServiceGVK = schema.GroupVersionKind{Group: "networking.istio.io", Version: "v1beta1", Kind: "VirtualService"}
+	IstioGatewayGVK   = schema.GroupVersionKind{Group: "networking.istio.io", Version: "v1beta1", Kind: "Gateway"}
+)
+
+// meshGateway is the reserved gateway name binding a VirtualService to the sidecars
+const meshGateway = "mesh"
+
+// GatewayRefs returns the Gateways a VirtualService is bound to, without the mesh
+func GatewayRefs(vs *unstructured.Unstructured) []types.NamespacedName {
+	gateways, _, _ := unstructured.NestedStringSlice(vs.Object, "spec", "gateways")
+	refs := make([]types.NamespacedName, 0, len(gateways))
+	for _, gateway := range gateways {
+		if gateway == "" || gateway == meshGateway {
+			continue
+		}
+		ref := types.NamespacedName{Namespace: vs.GetNamespace(), Name: gateway}
+		if namespace, name, ok := strings.Cut(gateway, "/"); ok {
+			ref = types.NamespacedName{Namespace: namespace, Name: name}
+		}
+		refs = append(refs, ref)
+	}
+	return refs
+}
+
+// gatewayListener is the protocol and port a Gateway server serves a host on
+type gatewayListener struct {
+	protocol string
+	port     string
+}
+
+// VirtualServiceChecks builds one check per host and path prefix of the http routes of a
+// VirtualService, on the hosts the given Gateways accept. The protocol and port come from
+// the Gateway server, https when it terminates or passes through TLS. Servers redirecting
+// to https and wildcard hosts get no check.
+func VirtualServiceChecks(vs *unstructured.Unstructured, gateways []*unstructured.Unstructured) ([]IngressInfo, error) {
+	hosts, _, _ := unstructured.NestedStringSlice(vs.Object, "spec", "hosts")
+	listeners := map[string]gatewayListener{}
+	for _, host := range hosts {
+		if host == "" || strings.Contains(host, "*") {
+			continue
+		}
+		for _, gateway := range gateways {
+			if listener, ok := gatewayListenerFor(gateway, vs.GetNamespace(), host); ok {
+				// Prefer https when several servers accept the host
+				if current, seen := listeners[host]; !seen || current.protocol != "https" {
+					listeners[host] = listener
+				}
+			}
+		}
+	}
+	if len(listeners) == 0 {
+		return nil, ErrNoHost
+	}
+
+	paths := virtualServicePaths(vs)
+	var targets []hostPath
+	for host, listener := range listeners {
+		for _, path := range paths {
+			targets = append(targets, hostPath{host: host, path: path, protocol: listener.protocol, port: listener.port})
+		}
+	}
+	sort.Slice(targets, func(i, j int) bool { return targets[i].host < targets[j].host })
+	return hostPathChecks(vs, targets, false)
+}
+
+// virtualServicePaths returns the prefix and exact uri matches of the http routes, or the
+// root when the routes match every path
+func virtualServicePaths(vs *unstructured.Unstructured) []string {
+	routes, _, _ := unstructured.NestedSlice(vs.Object, "spec", "http")
+	var paths []string
+	for _, item := range routes {
+		route, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		matches, _, _ := unstructured.NestedSlice(route, "match")
+		for _, match := range matches {
+			spec, ok := match.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			for _, field := range []string{"prefix", "exact"} {
+				if path, _, _ := unstructured.NestedString(spec, "uri", field); path != "" {
+					paths = append(paths, pathPrefix(path))
+				}
+			}
+		}
+	}
+	if len(paths) == 0 {
+		return []string{""}
+	}
+	return paths
+}
+
+// gatewayListenerFor returns the listener of the first server of the Gateway accepting the
+// host of a VirtualService in the given namespace
+func gatewayListenerFor(gateway *unstructured.Unstructured, namespace, host string) (gatewayListener, bool) {
+	servers, _, _ := unstructured.NestedSlice(gateway.Object, "spec", "servers")
+	for _, item := range servers {
+		server, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if redirect, _, _ := unstructured.NestedBool(server, "tls", "httpsRedirect"); redirect {
+			continue
+		}
+		serverHosts, _, _ := unstructured.NestedStringSlice(server, "hosts")
+		if !gatewayAcceptsHost(serverHosts, gateway.GetNamespace(), namespace, host) {
+			continue
+		}
+
+		number, _, _ := unstructured.NestedInt64(server, "port", "number")
+		protocol, _, _ := unstructured.NestedString(server, "port", "protocol")
+		mode, _, _ := unstructured.NestedString(server, "tls", "mode")
+		listener := gatewayListener{protocol: "http", port: "80"}
+		switch strings.ToUpper(protocol) {
+		case "HTTPS", "TLS":
+			listener = gatewayListener{protocol: "https", port: "443"}
+		case "HTTP", "HTTP2":
+		default:
+			if mode == "" {
+				continue
+			}
+			listener = gatewayListener{protocol: "https", port: "443"}
+		}
+		if number > 0 {
+			listener.port = strconv.FormatInt(number, 10)
+		}
+		return listener, true
+	}
+	return gatewayListener{}, false
+}
+
+// gatewayAcceptsHost reports whether the host list of a server of a Gateway in gatewayNamespace,
+// whose entries may be scoped to a namespace as ns/host, accepts the host of a VirtualService
+// in namespace
+func gatewayAcceptsHost(serverHosts []string, gatewayNamespace, namespace, host string) bool {
+	for _, pattern := range serverHosts {
+		if scope, rest, ok := strings.Cut(pattern, "/"); ok {
+			if scope == "." {
+				scope = gatewayNamespace
+			}
+			if scope != "*" && scope != namespace {
+				continue
+			}
+			pattern = rest
+		}
+		if hostMatches(pattern, host) {
+			return true
+		}
+	}
+	return false
+}
+
+// GatewayExposed reports whether a Gateway is reachable from outside the cluster: one of the
+// Services of type LoadBalancer selects the gateway pods its selector picks, or the Gateway
+// opts in with the wenti.dev/monitor annotation
+func GatewayExposed(gateway *unstructured.Unstructured, services []corev1.Service) bool {
+	if MonitorEnabled(gateway.GetAnnotations()) {
+		return true
+	}
+	selector, _, _ := unstructured.NestedStringMap(gateway.Object, "spec", "selector")
+	if len(selector) == 0 {
+		return false
+	}
+	for _, service := range services {
+		if service.Spec.Type != corev1.ServiceTypeLoadBalancer || len(service.Spec.Selector) == 0 {
+			continue
+		}
+		if SelectorsOverlap(service.Spec.Selector, selector) {
+			return true
+		}
+	}
+	return false
+}
+
+// SelectorsOverlap reports whether a Service and a Gateway selecting pods with these labels
+// pick the same gateway pods, as when one selector is a subset of the other. The Service of
+// the default install selects {app, istio} while its Gateway selects {istio} only.
+func SelectorsOverlap(service, gateway map[string]string) bool {
+	return labels.SelectorFromSet(service).Matches(labels.Set(gateway)) ||
+		labels.SelectorFromSet(gateway).Matches(labels.Set(service))
+}
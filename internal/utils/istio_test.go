@@ -0,0 +1,108 @@
+package utils
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+var _ = Describe("Istio checks", func() {
+	newGateway := func(name string, servers ...interface{}) *unstructured.Unstructured {
+		gateway := newSource(IstioGatewayGVK, map[string]interface{}{
+			"selector": map[string]interface{}{"istio": "ingressgateway"},
+			"servers":  servers,
+		})
+		gateway.SetNamespace("istio-system")
+		gateway.SetName(name)
+		return gateway
+	}
+	server := func(number int64, protocol string, tls map[string]interface{}, hosts ...interface{}) interface{} {
+		server := map[string]interface{}{
+			"port":  map[string]interface{}{"number": number, "protocol": protocol},
+			"hosts": hosts,
+		}
+		if tls != nil {
+			server["tls"] = tls
+		}
+		return server
+	}
+
+	It("should resolve the gateways of a virtual service", func() {
+		vs := newSource(VirtualServiceGVK, map[string]interface{}{
+			"gateways": []interface{}{"mesh", "public", "istio-system/public"},
+		})
+		Expect(GatewayRefs(vs)).To(Equal([]types.NamespacedName{
+			{Namespace: "shop", Name: "public"},
+			{Namespace: "istio-system", Name: "public"},
+		}))
+	})
+
+	It("should build one check per host and path on the gateway listener", func() {
+		gateway := newGateway("public",
+			server(80, "HTTP", map[string]interface{}{"httpsRedirect": true}, "*/shop.example.com"),
+			server(443, "HTTPS", map[string]interface{}{"mode": "SIMPLE"}, "shop/*.example.com"),
+		)
+		vs := newSource(VirtualServiceGVK, map[string]interface{}{
+			"hosts":    []interface{}{"shop.example.com", "*.example.com", "web.shop.svc.cluster.local"},
+			"gateways": []interface{}{"istio-system/public"},
+			"http": []interface{}{
+				map[string]interface{}{"match": []interface{}{
+					map[string]interface{}{"uri": map[string]interface{}{"prefix": "/api"}},
+					map[string]interface{}{"uri": map[string]interface{}{"regex": ".*"}},
+				}},
+				map[string]interface{}{"match": []interface{}{
+					map[string]interface{}{"uri": map[string]interface{}{"exact": "/healthz"}},
+				}},
+			},
+		})
+
+		checks, err := VirtualServiceChecks(vs, []*unstructured.Unstructured{gateway})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(checks).To(HaveLen(2))
+		Expect(checks[0].Owner).To(Equal("VirtualService/shop/web"))
+		Expect(checks[0].Key).To(Equal("shop.example.com/api"))
+		Expect(checks[0].Protocol).To(Equal("https"))
+		Expect(checks[0].Port).To(Equal("443"))
+		Expect(checks[1].Path).To(Equal("/healthz"))
+	})
+
+	It("should probe plain http servers at the root when no path is matched", func() {
+		gateway := newGateway("public", server(8080, "HTTP", nil, "*"))
+		vs := newSource(VirtualServiceGVK, map[string]interface{}{"hosts": []interface{}{"shop.example.com"}})
+
+		checks, err := VirtualServiceChecks(vs, []*unstructured.Unstructured{gateway})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(checks).To(HaveLen(1))
+		Expect(checks[0].Protocol).To(Equal("http"))
+		Expect(checks[0].Port).To(Equal("8080"))
+		Expect(checks[0].Path).To(Equal("/"))
+
+		other := newGateway("other", server(80, "HTTP", nil, "other/*"))
+		_, err = VirtualServiceChecks(vs, []*unstructured.Unstructured{other})
+		Expect(err).To(MatchError(ErrNoHost))
+	})
+
+	It("should only consider gateways selected by a load balancer", func() {
+		gateway := newGateway("public")
+		lb := corev1.Service{Spec: corev1.ServiceSpec{
+			Type:     corev1.ServiceTypeLoadBalancer,
+			Selector: map[string]string{"istio": "ingressgateway"},
+		}}
+		internal := lb
+		internal.Spec.Type = corev1.ServiceTypeClusterIP
+
+		Expect(GatewayExposed(gateway, []corev1.Service{internal})).To(BeFalse())
+		Expect(GatewayExposed(gateway, []corev1.Service{internal, lb})).To(BeTrue())
+
+		lb.Spec.Selector = map[string]string{"app": "istio-ingressgateway", "istio": "ingressgateway"}
+		Expect(GatewayExposed(gateway, []corev1.Service{lb})).To(BeTrue())
+		lb.Spec.Selector = map[string]string{"istio": "internalgateway"}
+		Expect(GatewayExposed(gateway, []corev1.Service{lb})).To(BeFalse())
+
+		gateway.SetAnnotations(map[string]string{Monitor: "true"})
+		Expect(GatewayExposed(gateway, nil)).To(BeTrue())
+	})
+})
@@ -0,0 +1,89 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// MaintenanceUntil holds an RFC3339 timestamp until which checks are disabled
+var MaintenanceUntil string = "wenti.dev/maintenance-until"
+
+// MaintenanceWindow holds a recurring window as a cron expression followed by a duration,
+// e.g. "0 2 * * 6 4h" for four hours every Saturday at 02:00 UTC
+var MaintenanceWindow string = "wenti.dev/maintenance-window"
+
+// Maintenance is the maintenance state of a resource at a point in time
+type Maintenance struct {
+	Active bool
+	// NextTransition is when the state changes next, zero if it never does
+	NextTransition time.Time
+}
+
+// GetMaintenance computes the maintenance state described by the annotations at now. An
+// invalid annotation is ignored and reported in the error, along with the state of the others.
+func GetMaintenance(annotations map[string]string, now time.Time) (Maintenance, error) {
+	maintenance := Maintenance{}
+	var errs []error
+
+	if value := annotations[MaintenanceUntil]; value != "" {
+		until, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid %s annotation: %w", MaintenanceUntil, err))
+		} else if now.Before(until) {
+			maintenance.Active = true
+			maintenance.NextTransition = until
+		}
+	}
+
+	if value := annotations[MaintenanceWindow]; value != "" {
+		window, err := recurringWindow(value, now)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid %s annotation: %w", MaintenanceWindow, err))
+		} else {
+			maintenance = maintenance.Merge(window)
+		}
+	}
+
+	return maintenance, errors.Join(errs...)
+}
+
+// Merge combines two maintenance states, the result is active if either is
+func (m Maintenance) Merge(other Maintenance) Maintenance {
+	merged := Maintenance{
+		Active:         m.Active || other.Active,
+		NextTransition: m.NextTransition,
+	}
+	if merged.NextTransition.IsZero() ||
+		(!other.NextTransition.IsZero() && other.NextTransition.Before(merged.NextTransition)) {
+		merged.NextTransition = other.NextTransition
+	}
+	return merged
+}
+
+func recurringWindow(value string, now time.Time) (Maintenance, error) {
+	value = strings.TrimSpace(value)
+	i := strings.LastIndex(value, " ")
+	if i < 0 {
+		return Maintenance{}, fmt.Errorf("expected a cron expression followed by a duration, got %q", value)
+	}
+	duration, err := time.ParseDuration(value[i+1:])
+	if err != nil {
+		return Maintenance{}, err
+	}
+	if duration <= 0 {
+		return Maintenance{}, fmt.Errorf("duration must be positive, got %s", duration)
+	}
+	schedule, err := ParseSchedule(value[:i])
+	if err != nil {
+		return Maintenance{}, err
+	}
+
+	// A window is active if it started less than duration ago
+	start := schedule.Next(now.Add(-duration))
+	if !start.IsZero() && !start.After(now) {
+		return Maintenance{Active: true, NextTransition: start.Add(duration)}, nil
+	}
+	return Maintenance{NextTransition: schedule.Next(now)}, nil
+}
@@ -0,0 +1,82 @@
+package utils
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Maintenance windows", func() {
+	// Saturday
+	now := time.Date(2024, time.June, 1, 3, 0, 0, 0, time.UTC)
+
+	Context("When parsing cron schedules", func() {
+		It("should compute the next activation", func() {
+			schedule, err := ParseSchedule("30 2 * * 1-5")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(schedule.Next(now)).To(Equal(time.Date(2024, time.June, 3, 2, 30, 0, 0, time.UTC)))
+		})
+
+		It("should support steps and Sunday as 7", func() {
+			schedule, err := ParseSchedule("*/15 0 * * 7")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(schedule.Next(now)).To(Equal(time.Date(2024, time.June, 2, 0, 0, 0, 0, time.UTC)))
+			Expect(schedule.Next(time.Date(2024, time.June, 2, 0, 0, 0, 0, time.UTC))).
+				To(Equal(time.Date(2024, time.June, 2, 0, 15, 0, 0, time.UTC)))
+		})
+
+		It("should reject invalid expressions", func() {
+			_, err := ParseSchedule("61 * * * *")
+			Expect(err).To(HaveOccurred())
+			_, err = ParseSchedule("* * *")
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Context("When reading maintenance annotations", func() {
+		It("should be active until the given timestamp", func() {
+			maintenance, err := GetMaintenance(map[string]string{
+				MaintenanceUntil: "2024-06-01T05:00:00Z",
+			}, now)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(maintenance.Active).To(BeTrue())
+			Expect(maintenance.NextTransition).To(Equal(time.Date(2024, time.June, 1, 5, 0, 0, 0, time.UTC)))
+		})
+
+		It("should be active inside a recurring window", func() {
+			maintenance, err := GetMaintenance(map[string]string{
+				MaintenanceWindow: "0 2 * * 6 2h",
+			}, now)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(maintenance.Active).To(BeTrue())
+			Expect(maintenance.NextTransition).To(Equal(time.Date(2024, time.June, 1, 4, 0, 0, 0, time.UTC)))
+		})
+
+		It("should wait for the next recurring window", func() {
+			maintenance, err := GetMaintenance(map[string]string{
+				MaintenanceUntil:  "2024-05-01T00:00:00Z",
+				MaintenanceWindow: "0 4 * * * 30m",
+			}, now)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(maintenance.Active).To(BeFalse())
+			Expect(maintenance.NextTransition).To(Equal(time.Date(2024, time.June, 1, 4, 0, 0, 0, time.UTC)))
+		})
+
+		It("should reject malformed annotations", func() {
+			_, err := GetMaintenance(map[string]string{MaintenanceUntil: "tomorrow"}, now)
+			Expect(err).To(HaveOccurred())
+			_, err = GetMaintenance(map[string]string{MaintenanceWindow: "0 2 * * 6"}, now)
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("should keep the valid annotations next to a malformed one", func() {
+			maintenance, err := GetMaintenance(map[string]string{
+				MaintenanceUntil:  "tomorrow",
+				MaintenanceWindow: "0 2 * * * 4h",
+			}, now)
+			Expect(err).To(MatchError(ContainSubstring(MaintenanceUntil)))
+			Expect(maintenance.NextTransition).NotTo(BeZero())
+		})
+	})
+})
@@ -0,0 +1,195 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+	"text/template"
+	"unicode"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Longest names and descriptions of checks the Wenti API accepts
+const (
+	DefaultMaxNameLength        = 100
+	DefaultMaxDescriptionLength = 500
+)
+
+// checkName are the characters the Wenti API accepts in the name of a check
+var checkName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9 _.:/@()-]*$`)
+
+// NameConfig holds the Go templates of the names and descriptions of the checks, rendered
+// with NameData. The defaults are kept when a template is empty.
+type NameConfig struct {
+	Name        string `json:"name,omitempty"`
+	Description string `json:"description,omitempty"`
+	// MaxNameLength and MaxDescriptionLength lower the lengths of the names and
+	// descriptions the API accepts, the defaults when zero
+	MaxNameLength        int `json:"maxNameLength,omitempty"`
+	MaxDescriptionLength int `json:"maxDescriptionLength,omitempty"`
+}
+
+// NameData is the data the name and description templates are rendered with
+type NameData struct {
+	Cluster     string
+	Kind        string
+	Namespace   string
+	Name        string
+	Host        string
+	Path        string
+	Port        string
+	Protocol    string
+	Labels      map[string]string
+	Annotations map[string]string
+}
+
+// NameTemplates are the compiled templates and the limits of the agent configuration file
+type NameTemplates struct {
+	name        *template.Template
+	description *template.Template
+
+	maxNameLength        int
+	maxDescriptionLength int
+}
+
+// Names are the templates naming the checks, the defaults when nil
+var Names *NameTemplates
+
+var nameFuncs = template.FuncMap{
+	"lower":   strings.ToLower,
+	"upper":   strings.ToUpper,
+	"replace": func(old, new, s string) string { return strings.ReplaceAll(s, old, new) },
+	"trunc": func(n int, s string) string {
+		if len(s) > n {
+			return s[:n]
+		}
+		return s
+	},
+	"default": func(fallback, value string) string {
+		if value == "" {
+			return fallback
+		}
+		return value
+	},
+}
+
+// CompileNames parses the templates, nil when neither a template nor a limit is set
+func CompileNames(config NameConfig) (*NameTemplates, error) {
+	if config == (NameConfig{}) {
+		return nil, nil
+	}
+	if config.MaxNameLength < 0 || config.MaxDescriptionLength < 0 {
+		return nil, fmt.Errorf("maxNameLength and maxDescriptionLength must not be negative")
+	}
+	templates := &NameTemplates{
+		maxNameLength:        config.MaxNameLength,
+		maxDescriptionLength: config.MaxDescriptionLength,
+	}
+	var err error
+	if config.Name != "" {
+		if templates.name, err = template.New("name").Funcs(nameFuncs).Option("missingkey=zero").Parse(config.Name); err != nil {
+			return nil, fmt.Errorf("name: %w", err)
+		}
+	}
+	if config.Description != "" {
+		if templates.description, err = template.New("description").Funcs(nameFuncs).Option("missingkey=zero").Parse(config.Description); err != nil {
+			return nil, fmt.Errorf("description: %w", err)
+		}
+	}
+	return templates, nil
+}
+
+// applyNames renders the name and description of a check of obj with the templates, when set,
+// and validates them
+func applyNames(check *IngressInfo, obj metav1.Object) error {
+	if Names != nil {
+		if err := renderNames(check, obj); err != nil {
+			return err
+		}
+	}
+	if err := ValidateName(check.Name); err != nil {
+		return err
+	}
+	return validateDescription(check.Description)
+}
+
+// renderNames renders the name and description of a check of obj with the templates
+func renderNames(check *IngressInfo, obj metav1.Object) error {
+	kind, _, _ := strings.Cut(check.Owner, "/")
+	data := NameData{
+		Cluster:     ClusterName,
+		Kind:        kind,
+		Namespace:   obj.GetNamespace(),
+		Name:        obj.GetName(),
+		Host:        check.Target,
+		Path:        check.Path,
+		Port:        check.Port,
+		Protocol:    check.Protocol,
+		Labels:      obj.GetLabels(),
+		Annotations: obj.GetAnnotations(),
+	}
+	if Names.name != nil {
+		name, err := render(Names.name, data)
+		if err != nil {
+			return err
+		}
+		check.Name = name
+	}
+	if Names.description != nil {
+		description, err := render(Names.description, data)
+		if err != nil {
+			return err
+		}
+		check.Description = description
+	}
+	return nil
+}
+
+func render(tmpl *template.Template, data NameData) (string, error) {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidCheck, err)
+	}
+	return strings.TrimSpace(buf.String()), nil
+}
+
+// nameLimits returns the longest name and description accepted
+func nameLimits() (int, int) {
+	maxName, maxDescription := DefaultMaxNameLength, DefaultMaxDescriptionLength
+	if Names != nil && Names.maxNameLength > 0 {
+		maxName = Names.maxNameLength
+	}
+	if Names != nil && Names.maxDescriptionLength > 0 {
+		maxDescription = Names.maxDescriptionLength
+	}
+	return maxName, maxDescription
+}
+
+// ValidateName returns an error when the API would reject the name of a check
+func ValidateName(name string) error {
+	maxName, _ := nameLimits()
+	switch {
+	case name == "":
+		return fmt.Errorf("%w: empty name", ErrInvalidCheck)
+	case len([]rune(name)) > maxName:
+		return fmt.Errorf("%w: name %q exceeds %d characters", ErrInvalidCheck, name, maxName)
+	case !checkName.MatchString(name):
+		return fmt.Errorf("%w: name %q has characters other than letters, digits, spaces and _.:/@()-",
+			ErrInvalidCheck, name)
+	}
+	return nil
+}
+
+// validateDescription returns an error when the API would reject the description of a check
+func validateDescription(description string) error {
+	_, maxDescription := nameLimits()
+	if length := len([]rune(description)); length > maxDescription {
+		return fmt.Errorf("%w: description of %d characters exceeds %d", ErrInvalidCheck, length, maxDescription)
+	}
+	if strings.IndexFunc(description, unicode.IsControl) >= 0 {
+		return fmt.Errorf("%w: description %q has control characters", ErrInvalidCheck, description)
+	}
+	return nil
+}
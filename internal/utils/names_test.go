@@ -0,0 +1,103 @@
+package utils
+
+import (
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("Name templates", func() {
+	ingress := &networkingv1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "shop",
+			Labels:      map[string]string{"team": "checkout"},
+			Annotations: map[string]string{"runbook": "https://runbooks.example.com/web", HealthCheckPath: "/healthz"}},
+		Spec: networkingv1.IngressSpec{Rules: []networkingv1.IngressRule{{Host: "shop.example.com"}}},
+	}
+
+	useNames := func(config NameConfig) {
+		names, err := CompileNames(config)
+		Expect(err).NotTo(HaveOccurred())
+		Names = names
+		DeferCleanup(func() { Names = nil })
+	}
+
+	It("should render names and descriptions from the resource", func() {
+		cluster := ClusterName
+		ClusterName = "prod"
+		DeferCleanup(func() { ClusterName = cluster })
+		useNames(NameConfig{
+			Name:        "{{ .Cluster }} {{ .Kind }} {{ .Namespace }}/{{ .Name }}",
+			Description: `{{ .Host }}{{ .Path }} owned by {{ index .Labels "team" }}, runbook {{ index .Annotations "runbook" }}`,
+		})
+
+		info, err := IngressInfoFromIngress(ingress)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(info.Name).To(Equal("prod Ingress shop/web"))
+		Expect(info.Description).To(Equal("shop.example.com/healthz owned by checkout, runbook https://runbooks.example.com/web"))
+	})
+
+	It("should rename the check when the template changes", func() {
+		_, before, err := DesiredSpec(mustIngressInfo(ingress))
+		Expect(err).NotTo(HaveOccurred())
+
+		useNames(NameConfig{Name: `{{ index .Labels "team" }}-{{ .Name }}`})
+		spec, after, err := DesiredSpec(mustIngressInfo(ingress))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(spec.Name).To(Equal("checkout-web"))
+		Expect(after).NotTo(Equal(before))
+	})
+
+	It("should reject empty names", func() {
+		useNames(NameConfig{Name: `{{ index .Labels "missing" }}`})
+		_, err := IngressInfoFromIngress(ingress)
+		Expect(err).To(MatchError(ErrInvalidCheck))
+
+		_, err = CompileNames(NameConfig{Name: "{{ .Name"})
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should reject rendered names the API would refuse", func() {
+		for _, config := range []NameConfig{
+			{Name: `{{ .Namespace }}{{ "\n" }}{{ .Name }}`},
+			{Name: `{{ index .Labels "team" }}#{{ .Name }}`},
+			{Name: `{{ printf "%0101d" 0 }}`},
+			{Description: `{{ .Name }}{{ "\t" }}{{ .Host }}`},
+			{Description: `{{ printf "%0501d" 0 }}`},
+		} {
+			useNames(config)
+			_, err := IngressInfoFromIngress(ingress)
+			Expect(err).To(MatchError(ErrInvalidCheck), config.Name+config.Description)
+		}
+
+		Expect(ValidateName("shop/web (prod)")).To(Succeed())
+		Expect(ValidateName("web\nprod")).To(MatchError(ErrInvalidCheck))
+		Expect(ValidateName(strings.Repeat("a", DefaultMaxNameLength+1))).To(MatchError(ErrInvalidCheck))
+	})
+
+	It("should lower the limits to the ones the configuration sets", func() {
+		useNames(NameConfig{Description: "{{ .Host }}{{ .Path }} owned by the checkout team"})
+		Expect(IngressInfoFromIngress(ingress)).Error().NotTo(HaveOccurred())
+
+		useNames(NameConfig{MaxNameLength: len("shop_web"), MaxDescriptionLength: 20})
+		_, err := IngressInfoFromIngress(ingress)
+		Expect(err).NotTo(HaveOccurred())
+
+		useNames(NameConfig{Description: "{{ .Host }}{{ .Path }} owned by the checkout team", MaxDescriptionLength: 20})
+		_, err = IngressInfoFromIngress(ingress)
+		Expect(err).To(MatchError(ErrInvalidCheck))
+		Expect(err).To(MatchError(ContainSubstring("exceeds 20")))
+
+		_, err = CompileNames(NameConfig{MaxNameLength: -1})
+		Expect(err).To(HaveOccurred())
+	})
+})
+
+func mustIngressInfo(ingress *networkingv1.Ingress) IngressInfo {
+	info, err := IngressInfoFromIngress(ingress)
+	Expect(err).NotTo(HaveOccurred())
+	return info
+}
@@ -0,0 +1,130 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	monitoringv1alpha1 "github.com/wentidev/agent/api/v1alpha1"
+)
+
+// ErrPolicyViolation is returned for checks a HealthCheckPolicy rejects
+var ErrPolicyViolation = errors.New("health check policy violation")
+
+// Policy rules, reported in the violation events and metric
+const (
+	PolicyMinInterval      = "minInterval"
+	PolicyMaxTimeout       = "maxTimeout"
+	PolicyMaxChecks        = "maxChecks"
+	PolicyAllowedProtocols = "allowedProtocols"
+	PolicyAllowedMethods   = "allowedMethods"
+)
+
+// PolicyViolation is a setting of a check which breaks a policy, clamped unless Rejected, in
+// which case the check is disabled or, over the quota, deleted
+type PolicyViolation struct {
+	Rule     string
+	Message  string
+	Rejected bool
+}
+
+// Action returns what became of the check breaking the rule, "clamped" or "rejected"
+func (v PolicyViolation) Action() string {
+	if v.Rejected {
+		return "rejected"
+	}
+	return "clamped"
+}
+
+// Policy holds the most restrictive bounds of the policies applying to a namespace. Zero
+// durations and a negative MaxChecks are unbounded, nil lists allow any value.
+type Policy struct {
+	MinInterval time.Duration
+	MaxTimeout  time.Duration
+	MaxChecks   int
+	Protocols   []string
+	Methods     []string
+}
+
+// MergePolicies returns the policy enforcing every spec
+func MergePolicies(specs ...monitoringv1alpha1.HealthCheckPolicySpec) Policy {
+	policy := Policy{MaxChecks: -1}
+	for _, spec := range specs {
+		if spec.MinInterval != nil && spec.MinInterval.Duration > policy.MinInterval {
+			policy.MinInterval = spec.MinInterval.Duration
+		}
+		if spec.MaxTimeout != nil && (policy.MaxTimeout == 0 || spec.MaxTimeout.Duration < policy.MaxTimeout) {
+			policy.MaxTimeout = spec.MaxTimeout.Duration
+		}
+		if spec.MaxChecks != nil && (policy.MaxChecks < 0 || int(*spec.MaxChecks) < policy.MaxChecks) {
+			policy.MaxChecks = int(*spec.MaxChecks)
+		}
+		policy.Protocols = intersect(policy.Protocols, spec.AllowedProtocols)
+		policy.Methods = intersect(policy.Methods, spec.AllowedMethods)
+	}
+	return policy
+}
+
+// intersect returns the values allowed by both lists, where nil allows any value
+func intersect(allowed, values []string) []string {
+	if len(values) == 0 {
+		return allowed
+	}
+	if allowed == nil {
+		return values
+	}
+	both := []string{}
+	for _, value := range values {
+		if containsFold(allowed, value) {
+			both = append(both, value)
+		}
+	}
+	return both
+}
+
+// Apply clamps the interval and timeout of the resource to the policy, disables it if the
+// policy rejects its protocol or method, and returns its violations
+func (p Policy) Apply(resource *IngressInfo) []PolicyViolation {
+	var violations []PolicyViolation
+	if p.Protocols != nil && !containsFold(p.Protocols, resource.Protocol) {
+		violations = append(violations, PolicyViolation{Rule: PolicyAllowedProtocols, Rejected: true,
+			Message: fmt.Sprintf("protocol %q is not allowed, expected one of %s", resource.Protocol, strings.Join(p.Protocols, ", "))})
+	}
+	if p.Methods != nil && IsHTTPProtocol(strings.ToLower(resource.Protocol)) && !containsFold(p.Methods, resource.Method) {
+		violations = append(violations, PolicyViolation{Rule: PolicyAllowedMethods, Rejected: true,
+			Message: fmt.Sprintf("method %q is not allowed, expected one of %s", resource.Method, strings.Join(p.Methods, ", "))})
+	}
+
+	// The API counts in whole seconds, so the bounds are rounded up to them
+	if interval, err := ConvertDurationToSeconds(resource.Interval); err == nil && p.MinInterval > 0 &&
+		time.Duration(interval)*time.Second < p.MinInterval {
+		resource.Interval = wholeSeconds(p.MinInterval)
+		violations = append(violations, PolicyViolation{Rule: PolicyMinInterval,
+			Message: fmt.Sprintf("interval %ds raised to the minimum of %s", interval, resource.Interval)})
+	}
+	if timeout, err := ConvertDurationToSeconds(resource.Timeout); err == nil && p.MaxTimeout > 0 &&
+		time.Duration(timeout)*time.Second > (p.MaxTimeout+time.Second-1).Truncate(time.Second) {
+		resource.Timeout = wholeSeconds(p.MaxTimeout)
+		violations = append(violations, PolicyViolation{Rule: PolicyMaxTimeout,
+			Message: fmt.Sprintf("timeout %ds lowered to the maximum of %s", timeout, resource.Timeout)})
+	}
+	for _, violation := range violations {
+		if violation.Rejected {
+			resource.Enabled = false
+		}
+	}
+	return violations
+}
+
+// Quota returns the violation of adding count checks to a namespace which has existing ones
+// owned by other resources, if any. Callers hold LockNamespace until the checks are synced
+// so that concurrent reconciles count each other's checks.
+func (p Policy) Quota(existing, count int) []PolicyViolation {
+	if p.MaxChecks < 0 || existing+count <= p.MaxChecks {
+		return nil
+	}
+	return []PolicyViolation{{Rule: PolicyMaxChecks, Rejected: true,
+		Message: fmt.Sprintf("%d checks would exceed the quota of %d checks in the namespace, which has %d",
+			count, p.MaxChecks, existing)}}
+}
@@ -0,0 +1,111 @@
+package utils
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	monitoringv1alpha1 "github.com/wentidev/agent/api/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("Health check policies", func() {
+	duration := func(d time.Duration) *metav1.Duration { return &metav1.Duration{Duration: d} }
+	maxChecks := func(n int32) *int32 { return &n }
+
+	It("should merge the most restrictive bounds", func() {
+		policy := MergePolicies(
+			monitoringv1alpha1.HealthCheckPolicySpec{
+				MinInterval:      duration(30 * time.Second),
+				MaxChecks:        maxChecks(10),
+				AllowedProtocols: []string{"http", "https"},
+			},
+			monitoringv1alpha1.HealthCheckPolicySpec{
+				MinInterval:      duration(10 * time.Second),
+				MaxTimeout:       duration(5 * time.Second),
+				MaxChecks:        maxChecks(3),
+				AllowedProtocols: []string{"https", "tcp"},
+			},
+		)
+		Expect(policy.MinInterval).To(Equal(30 * time.Second))
+		Expect(policy.MaxTimeout).To(Equal(5 * time.Second))
+		Expect(policy.MaxChecks).To(Equal(3))
+		Expect(policy.Protocols).To(Equal([]string{"https"}))
+		Expect(policy.Methods).To(BeNil())
+	})
+
+	It("should clamp the interval and the timeout", func() {
+		policy := MergePolicies(monitoringv1alpha1.HealthCheckPolicySpec{
+			MinInterval: duration(time.Minute),
+			MaxTimeout:  duration(10 * time.Second),
+		})
+		resource := NewIngressInfo()
+		resource.Interval = "1s"
+
+		violations := policy.Apply(&resource)
+		Expect(violations).To(HaveLen(2))
+		Expect(violations[0].Rule).To(Equal(PolicyMinInterval))
+		Expect(violations[0].Action()).To(Equal("clamped"))
+		Expect(resource.Interval).To(Equal("60s"))
+		Expect(resource.Timeout).To(Equal("10s"))
+		Expect(resource.Enabled).To(BeTrue())
+	})
+
+	It("should round the bounds up to whole seconds", func() {
+		policy := MergePolicies(monitoringv1alpha1.HealthCheckPolicySpec{
+			MinInterval: duration(1500 * time.Millisecond),
+			MaxTimeout:  duration(500 * time.Millisecond),
+		})
+		resource := NewIngressInfo()
+		resource.Interval = "1s"
+
+		Expect(policy.Apply(&resource)).To(HaveLen(2))
+		Expect(resource.Interval).To(Equal("2s"))
+		Expect(resource.Timeout).To(Equal("1s"))
+		Expect(ValidateIngressInfo(resource)).To(BeEmpty())
+		Expect(policy.Apply(&resource)).To(BeEmpty())
+	})
+
+	It("should reject the protocols and methods it does not allow", func() {
+		policy := MergePolicies(monitoringv1alpha1.HealthCheckPolicySpec{
+			AllowedProtocols: []string{"https", "tcp"},
+			AllowedMethods:   []string{"GET", "HEAD"},
+		})
+		resource := NewIngressInfo()
+		resource.Method = "POST"
+
+		violations := policy.Apply(&resource)
+		Expect(violations).To(HaveLen(2))
+		Expect(violations[0].Rule).To(Equal(PolicyAllowedProtocols))
+		Expect(violations[1].Rule).To(Equal(PolicyAllowedMethods))
+		Expect(violations[1].Rejected).To(BeTrue())
+		Expect(resource.Enabled).To(BeFalse())
+
+		resource = NewIngressInfo()
+		resource.Protocol, resource.Method = ProtocolTCP, ""
+		Expect(policy.Apply(&resource)).To(BeEmpty())
+	})
+
+	It("should reject the checks over the quota", func() {
+		policy := MergePolicies(monitoringv1alpha1.HealthCheckPolicySpec{MaxChecks: maxChecks(2)})
+		Expect(policy.Quota(1, 1)).To(BeEmpty())
+		Expect(policy.Quota(1, 2)).To(ConsistOf(HaveField("Rule", PolicyMaxChecks)))
+		Expect(MergePolicies().Quota(100, 1)).To(BeEmpty())
+	})
+
+	It("should count the checks of a namespace", func() {
+		cache := NewCheckCache()
+		for id, owner := range map[string]string{
+			"1": OwnerKey("Ingress", "shop", "web"),
+			"2": OwnerKey("Service", "shop", "api"),
+			"3": OwnerKey("Ingress", "blog", "web"),
+		} {
+			cache.Put(RemoteCheck{ID: id, Labels: map[string]string{
+				ManagedByLabel: ManagedByValue, ClusterLabel: ClusterName, OwnerLabel: owner,
+			}})
+		}
+		Expect(cache.CountInNamespace("shop", "")).To(Equal(2))
+		Expect(cache.CountInNamespace("shop", OwnerKey("Ingress", "shop", "web"))).To(Equal(1))
+	})
+})
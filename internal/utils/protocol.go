@@ -0,0 +1,95 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Protocols of the checks
+const (
+	ProtocolHTTP  = "http"
+	ProtocolHTTPS = "https"
+	// ProtocolGRPC and ProtocolGRPCS call the grpc.health.v1.Health service, in clear text and over TLS
+	ProtocolGRPC  = "grpc"
+	ProtocolGRPCS = "grpcs"
+	// ProtocolTCP and ProtocolTLS only open a connection, and complete a TLS handshake on it
+	ProtocolTCP = "tcp"
+	ProtocolTLS = "tls"
+)
+
+var protocols = []string{ProtocolHTTP, ProtocolHTTPS, ProtocolGRPC, ProtocolGRPCS, ProtocolTCP, ProtocolTLS}
+
+// HealthCheckGRPCService is the service a gRPC check asks the health of, the whole server when empty
+var HealthCheckGRPCService string = "wenti.dev/health-check-grpc-service"
+
+// ErrInvalidCheck is returned for checks whose settings do not fit their protocol
+var ErrInvalidCheck = errors.New("invalid health check")
+
+var grpcServiceName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)*$`)
+
+// IsHTTPProtocol reports whether checks on the protocol send an HTTP request
+func IsHTTPProtocol(protocol string) bool {
+	return protocol == ProtocolHTTP || protocol == ProtocolHTTPS
+}
+
+// IsGRPCProtocol reports whether checks on the protocol call the gRPC health service
+func IsGRPCProtocol(protocol string) bool {
+	return protocol == ProtocolGRPC || protocol == ProtocolGRPCS
+}
+
+// applyProtocol drops the HTTP defaults of a check on another protocol, keeping the settings
+// the annotations set so that validation reports them
+func applyProtocol(resource *IngressInfo, annotations map[string]string) {
+	resource.Protocol = strings.ToLower(resource.Protocol)
+	if value := annotations[HealthCheckGRPCService]; value != "" {
+		resource.GRPCService = value
+	}
+	if IsHTTPProtocol(resource.Protocol) {
+		return
+	}
+	for annotation, setting := range map[string]*string{
+		HealthCheckPath:     &resource.Path,
+		HealthCheckMethod:   &resource.Method,
+		HealthCheckHTTPCode: &resource.HTTPCode,
+	} {
+		if annotations[annotation] == "" {
+			*setting = ""
+		}
+	}
+}
+
+// ValidateProtocol returns the settings of the resource which do not fit its protocol
+func ValidateProtocol(resource IngressInfo) []error {
+	if !containsFold(protocols, resource.Protocol) {
+		return []error{fmt.Errorf("%w: %s: unsupported protocol %q, expected one of %s", ErrInvalidCheck,
+			HealthCheckProtocol, resource.Protocol, strings.Join(protocols, ", "))}
+	}
+	protocol := strings.ToLower(resource.Protocol)
+	if IsHTTPProtocol(protocol) {
+		if resource.GRPCService != "" {
+			return []error{fmt.Errorf("%w: %s only applies to grpc checks", ErrInvalidCheck, HealthCheckGRPCService)}
+		}
+		return nil
+	}
+
+	var errs []error
+	for annotation, value := range map[string]string{
+		HealthCheckPath:     resource.Path,
+		HealthCheckMethod:   resource.Method,
+		HealthCheckHTTPCode: resource.HTTPCode,
+	} {
+		if value != "" {
+			errs = append(errs, fmt.Errorf("%w: %s does not apply to %s checks", ErrInvalidCheck, annotation, protocol))
+		}
+	}
+	switch {
+	case !IsGRPCProtocol(protocol) && resource.GRPCService != "":
+		errs = append(errs, fmt.Errorf("%w: %s only applies to grpc checks", ErrInvalidCheck, HealthCheckGRPCService))
+	case resource.GRPCService != "" && !grpcServiceName.MatchString(resource.GRPCService):
+		errs = append(errs, fmt.Errorf("%w: %s: invalid service name %q", ErrInvalidCheck,
+			HealthCheckGRPCService, resource.GRPCService))
+	}
+	return errs
+}
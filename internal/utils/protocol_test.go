@@ -0,0 +1,55 @@
+package utils
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Check protocols", func() {
+	check := func(annotations map[string]string) IngressInfo {
+		info := NewIngressInfo()
+		info.Target = "example.com"
+		ApplyAnnotations(&info, annotations)
+		return info
+	}
+
+	It("should drop the HTTP defaults of tcp and grpc checks", func() {
+		info := check(map[string]string{HealthCheckProtocol: "TCP"})
+		Expect(info.Protocol).To(Equal(ProtocolTCP))
+		Expect(info.Path).To(BeEmpty())
+		Expect(info.Method).To(BeEmpty())
+		Expect(info.HTTPCode).To(BeEmpty())
+		Expect(ValidateIngressInfo(info)).To(BeEmpty())
+
+		info = check(map[string]string{HealthCheckProtocol: "grpc"})
+		spec, _, err := DesiredSpec(info)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(spec.Path).To(BeEmpty())
+		Expect(spec.Body).To(BeNil())
+
+		info = check(map[string]string{HealthCheckProtocol: "grpc", HealthCheckGRPCService: "shop.v1.Cart"})
+		spec, _, err = DesiredSpec(info)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(spec.Body).NotTo(BeNil())
+		Expect(*spec.Body).To(Equal(`{"service":"shop.v1.Cart"}`))
+	})
+
+	It("should reject settings which do not fit the protocol", func() {
+		info := check(map[string]string{HealthCheckProtocol: "tcp", HealthCheckPath: "/healthz"})
+		Expect(ValidateIngressInfo(info)).To(ContainElement(MatchError(ContainSubstring(HealthCheckPath))))
+		_, _, err := DesiredSpec(info)
+		Expect(err).To(MatchError(ErrInvalidCheck))
+
+		info = check(map[string]string{HealthCheckProtocol: "grpc", HealthCheckMethod: "POST"})
+		Expect(ValidateIngressInfo(info)).To(ContainElement(MatchError(ContainSubstring(HealthCheckMethod))))
+
+		info = check(map[string]string{HealthCheckGRPCService: "shop.Cart"})
+		Expect(ValidateIngressInfo(info)).To(ContainElement(MatchError(ContainSubstring("only applies to grpc"))))
+
+		info = check(map[string]string{HealthCheckProtocol: "grpc", HealthCheckGRPCService: "shop/Cart"})
+		Expect(ValidateIngressInfo(info)).To(ContainElement(MatchError(ContainSubstring("invalid service name"))))
+
+		info = check(map[string]string{HealthCheckProtocol: "ftp"})
+		Expect(ValidateIngressInfo(info)).To(ContainElement(MatchError(ContainSubstring("unsupported protocol"))))
+	})
+})
@@ -0,0 +1,114 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/wentidev/agent/internal/metrics"
+	"golang.org/x/time/rate"
+)
+
+var (
+	limiterOnce sync.Once
+	limiter     *rate.Limiter
+)
+
+// apiLimiter returns the token bucket shared by every request sent to the server
+func apiLimiter() *rate.Limiter {
+	limiterOnce.Do(func() {
+		limit := rate.Limit(APIRateLimit)
+		if APIRateLimit <= 0 {
+			limit = rate.Inf
+		}
+		limiter = rate.NewLimiter(limit, APIBurst)
+	})
+	return limiter
+}
+
+// RateLimitInterceptor delays the request until the shared rate limiter allows it
+func RateLimitInterceptor(ctx context.Context, req *http.Request) error {
+	reservation := apiLimiter().Reserve()
+	if !reservation.OK() {
+		return fmt.Errorf("request exceeds the rate limiter burst")
+	}
+	delay := reservation.Delay()
+	if delay == 0 {
+		return nil
+	}
+
+	metrics.APIThrottled.Inc()
+	metrics.APIThrottleWait.Observe(delay.Seconds())
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		reservation.Cancel()
+		return ctx.Err()
+	}
+}
+
+// ValidateRateLimit rejects a burst that would make every request fail under a positive rate
+func ValidateRateLimit() error {
+	if APIRateLimit > 0 && APIBurst < 1 {
+		return fmt.Errorf("--api-burst must be at least 1 when --api-rate-limit is set, got %d", APIBurst)
+	}
+	return nil
+}
+
+type targetLock struct {
+	mu    sync.Mutex
+	users int
+}
+
+var (
+	targetLocksMu sync.Mutex
+	targetLocks   = map[string]*targetLock{}
+)
+
+// lockKey identifies the remote check of the resource: its owner when it has one, as
+// deletes only carry the owner, otherwise its target
+func lockKey(resource IngressInfo) string {
+	if resource.Owner != "" {
+		return resource.Owner
+	}
+	return fmt.Sprintf("%s|%s|%s|%s", resource.Target, resource.Port, resource.Method, resource.Path)
+}
+
+// LockTarget serializes the operations on the remote check of the resource,
+// the returned function releases the lock
+func LockTarget(resource IngressInfo) func() {
+	return acquire(lockKey(resource))
+}
+
+// LockNamespace serializes the checks of the quota of a namespace with the syncs of its
+// checks, the returned function releases the lock
+func LockNamespace(namespace string) func() {
+	return acquire("namespace|" + namespace)
+}
+
+// acquire takes the lock of the key, created on first use and dropped with its last user
+func acquire(key string) func() {
+	targetLocksMu.Lock()
+	lock, ok := targetLocks[key]
+	if !ok {
+		lock = &targetLock{}
+		targetLocks[key] = lock
+	}
+	lock.users++
+	targetLocksMu.Unlock()
+
+	lock.mu.Lock()
+	return func() {
+		lock.mu.Unlock()
+		targetLocksMu.Lock()
+		defer targetLocksMu.Unlock()
+		if lock.users--; lock.users == 0 {
+			delete(targetLocks, key)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package utils
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Rate limit flags", func() {
+	It("should reject an empty burst under a positive rate", func() {
+		rate, burst := APIRateLimit, APIBurst
+		DeferCleanup(func() { APIRateLimit, APIBurst = rate, burst })
+
+		APIRateLimit, APIBurst = 10, 0
+		Expect(ValidateRateLimit()).To(HaveOccurred())
+		APIRateLimit, APIBurst = 0, 0
+		Expect(ValidateRateLimit()).To(Succeed())
+		APIRateLimit, APIBurst = 10, 1
+		Expect(ValidateRateLimit()).To(Succeed())
+	})
+})
+
+var _ = Describe("Target locks", func() {
+	owner := OwnerKey("Ingress", "shop", "web")
+
+	It("should serialize the delete of a check with its update", func() {
+		unlock := LockTarget(IngressInfo{Owner: owner, Target: "shop.example.com", Port: "443", Method: "GET", Path: "/"})
+		acquired := make(chan struct{})
+		go func() {
+			defer GinkgoRecover()
+			LockTarget(IngressInfo{Name: "web", Owner: owner})()
+			close(acquired)
+		}()
+
+		Consistently(acquired, 50*time.Millisecond).ShouldNot(BeClosed())
+		unlock()
+		Eventually(acquired).Should(BeClosed())
+	})
+
+	It("should not serialize different owners", func() {
+		unlock := LockTarget(IngressInfo{Owner: owner})
+		defer unlock()
+		LockTarget(IngressInfo{Owner: OwnerKey("Ingress", "shop", "api")})()
+	})
+
+	It("should serialize the reconciles of a namespace apart from its checks", func() {
+		unlock := LockNamespace("shop")
+		LockTarget(IngressInfo{Owner: owner})()
+		LockNamespace("blog")()
+
+		acquired := make(chan struct{})
+		go func() {
+			defer GinkgoRecover()
+			LockNamespace("shop")()
+			close(acquired)
+		}()
+		Consistently(acquired, 50*time.Millisecond).ShouldNot(BeClosed())
+		unlock()
+		Eventually(acquired).Should(BeClosed())
+	})
+
+	It("should fall back to the target without an owner", func() {
+		Expect(lockKey(IngressInfo{Target: "shop.example.com", Port: "443", Method: "GET", Path: "/"})).
+			To(Equal("shop.example.com|443|GET|/"))
+	})
+
+	It("should forget the locks no longer used", func() {
+		first := LockTarget(IngressInfo{Owner: owner})
+		second := make(chan func())
+		go func() { second <- LockTarget(IngressInfo{Owner: owner}) }()
+		first()
+		(<-second)()
+
+		targetLocksMu.Lock()
+		defer targetLocksMu.Unlock()
+		Expect(targetLocks).To(BeEmpty())
+	})
+})
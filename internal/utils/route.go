@@ -0,0 +1,55 @@
+package utils
+
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// RouteGVK is the OpenShift Route kind
+var RouteGVK = schema.GroupVersionKind{Group: "route.openshift.io", Version: "v1", Kind: "Route"}
+
+// RouteChecks builds the check of an OpenShift Route from its host, path and TLS termination,
+// the defaults and the wenti.dev/health-check-* annotations
+func RouteChecks(route *unstructured.Unstructured) ([]IngressInfo, error) {
+	host, _, _ := unstructured.NestedString(route.Object, "spec", "host")
+	if host == "" {
+		// The host generated by the router when the spec leaves it empty
+		ingresses, _, _ := unstructured.NestedSlice(route.Object, "status", "ingress")
+		if len(ingresses) > 0 {
+			if ingress, ok := ingresses[0].(map[string]interface{}); ok {
+				host, _, _ = unstructured.NestedString(ingress, "host")
+			}
+		}
+	}
+	if host == "" {
+		return nil, ErrNoHost
+	}
+
+	check := NewIngressInfo()
+	check.Name = fmt.Sprintf("%s_%s", route.GetNamespace(), route.GetName())
+	check.Description = check.Name
+	check.Owner = OwnerKey(RouteGVK.Kind, route.GetNamespace(), route.GetName())
+	check.Target = host
+	check.Port = "80"
+	check.Protocol = "http"
+	if termination, _, _ := unstructured.NestedString(route.Object, "spec", "tls", "termination"); termination != "" {
+		check.Port = "443"
+		check.Protocol = "https"
+	}
+	if path, _, _ := unstructured.NestedString(route.Object, "spec", "path"); path != "" {
+		check.Path = path
+	}
+
+	annotations := route.GetAnnotations()
+	if value := annotations[HealthCheckPort]; value != "" {
+		check.Port = value
+	}
+	ApplyAnnotations(&check, annotations)
+	check.ID = annotations[HealthCheckID]
+	if err := applyNames(&check, route); err != nil {
+		return nil, err
+	}
+	return []IngressInfo{check}, nil
+}
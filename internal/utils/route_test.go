@@ -0,0 +1,52 @@
+package utils
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+var _ = Describe("Route checks", func() {
+	newRoute := func(spec map[string]interface{}) *unstructured.Unstructured {
+		route := &unstructured.Unstructured{Object: map[string]interface{}{"spec": spec}}
+		route.SetGroupVersionKind(RouteGVK)
+		route.SetNamespace("shop")
+		route.SetName("web")
+		return route
+	}
+
+	It("should derive host, path and protocol from the route", func() {
+		route := newRoute(map[string]interface{}{
+			"host": "shop.example.com",
+			"path": "/api",
+			"tls":  map[string]interface{}{"termination": "edge"},
+		})
+		route.SetAnnotations(map[string]string{HealthCheckMethod: "HEAD"})
+
+		checks, err := RouteChecks(route)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(checks).To(HaveLen(1))
+		Expect(checks[0].Owner).To(Equal("Route/shop/web"))
+		Expect(checks[0].Target).To(Equal("shop.example.com"))
+		Expect(checks[0].Path).To(Equal("/api"))
+		Expect(checks[0].Protocol).To(Equal("https"))
+		Expect(checks[0].Port).To(Equal("443"))
+		Expect(checks[0].Method).To(Equal("HEAD"))
+	})
+
+	It("should fall back to the host admitted by the router", func() {
+		route := newRoute(map[string]interface{}{})
+		route.Object["status"] = map[string]interface{}{
+			"ingress": []interface{}{map[string]interface{}{"host": "web-shop.apps.example.com"}},
+		}
+
+		checks, err := RouteChecks(route)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(checks[0].Target).To(Equal("web-shop.apps.example.com"))
+		Expect(checks[0].Protocol).To(Equal("http"))
+
+		_, err = RouteChecks(newRoute(map[string]interface{}{}))
+		Expect(err).To(MatchError(ErrNoHost))
+	})
+})
@@ -0,0 +1,188 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/google/cel-go/cel"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// ErrNotMonitored is returned for resources a rule opts out of monitoring
+var ErrNotMonitored = errors.New("resource not monitored")
+
+// Rule is a CEL policy evaluated against every Ingress before its annotations, with the
+// variables ingress (the whole object), ns (the name, labels and annotations of its namespace,
+// as namespace is a reserved word in CEL) and cluster
+type Rule struct {
+	Name string `json:"name"`
+	// When selects the Ingresses the rule applies to, all of them when empty
+	When string `json:"when,omitempty"`
+	// Monitor decides whether the selected Ingresses are monitored
+	Monitor string `json:"monitor,omitempty"`
+	// Set computes settings of the check, such as interval: "ns.labels.tier == 'prod' ? 30 : 300"
+	Set map[string]string `json:"set,omitempty"`
+}
+
+// RuleSet is the compiled rules, applied in order so that later rules override earlier ones
+type RuleSet []compiledRule
+
+// Rules are the rules of the agent configuration file
+var Rules RuleSet
+
+type compiledRule struct {
+	name    string
+	when    cel.Program
+	monitor cel.Program
+	set     map[string]cel.Program
+}
+
+// ruleFields maps the settings a rule can compute to the field of the check
+var ruleFields = map[string]func(*IngressInfo) *string{
+	"path":         func(r *IngressInfo) *string { return &r.Path },
+	"method":       func(r *IngressInfo) *string { return &r.Method },
+	"protocol":     func(r *IngressInfo) *string { return &r.Protocol },
+	"port":         func(r *IngressInfo) *string { return &r.Port },
+	"timeout":      func(r *IngressInfo) *string { return &r.Timeout },
+	"interval":     func(r *IngressInfo) *string { return &r.Interval },
+	"successCodes": func(r *IngressInfo) *string { return &r.HTTPCode },
+}
+
+// CompileRules checks and compiles the rules
+func CompileRules(rules []Rule) (RuleSet, error) {
+	env, err := cel.NewEnv(
+		cel.Variable("ingress", cel.DynType),
+		cel.Variable("ns", cel.DynType),
+		cel.Variable("cluster", cel.StringType),
+	)
+	if err != nil {
+		return nil, err
+	}
+	compile := func(expression string) (cel.Program, error) {
+		if expression == "" {
+			return nil, nil
+		}
+		ast, issues := env.Compile(expression)
+		if issues != nil && issues.Err() != nil {
+			return nil, issues.Err()
+		}
+		return env.Program(ast)
+	}
+
+	set := make(RuleSet, 0, len(rules))
+	for i, rule := range rules {
+		name := rule.Name
+		if name == "" {
+			name = fmt.Sprintf("rules[%d]", i)
+		}
+		compiled := compiledRule{name: name, set: map[string]cel.Program{}}
+		if compiled.when, err = compile(rule.When); err != nil {
+			return nil, fmt.Errorf("%s: when: %w", name, err)
+		}
+		if compiled.monitor, err = compile(rule.Monitor); err != nil {
+			return nil, fmt.Errorf("%s: monitor: %w", name, err)
+		}
+		for field, expression := range rule.Set {
+			if _, ok := ruleFields[field]; !ok {
+				return nil, fmt.Errorf("%s: unknown setting %q, expected one of %s", name, field, strings.Join(ruleFieldNames(), ", "))
+			}
+			if compiled.set[field], err = compile(expression); err != nil {
+				return nil, fmt.Errorf("%s: set %s: %w", name, field, err)
+			}
+		}
+		set = append(set, compiled)
+	}
+	return set, nil
+}
+
+func ruleFieldNames() []string {
+	names := make([]string, 0, len(ruleFields))
+	for name := range ruleFields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// RuleInput returns the variables the rules are evaluated with for an Ingress in its namespace
+func RuleInput(ingress *networkingv1.Ingress, namespace *corev1.Namespace) (map[string]interface{}, error) {
+	object, err := runtime.DefaultUnstructuredConverter.ToUnstructured(ingress)
+	if err != nil {
+		return nil, err
+	}
+	ns := map[string]interface{}{"name": ingress.Namespace, "labels": map[string]string{}, "annotations": map[string]string{}}
+	if namespace != nil {
+		if namespace.Labels != nil {
+			ns["labels"] = namespace.Labels
+		}
+		if namespace.Annotations != nil {
+			ns["annotations"] = namespace.Annotations
+		}
+	}
+	return map[string]interface{}{"ingress": object, "ns": ns, "cluster": ClusterName}, nil
+}
+
+// Apply evaluates the rules and sets the settings they compute on the resource. It returns
+// false when a rule opts the resource out of monitoring. A missing field, such as an absent
+// label, makes the expression reading it skipped rather than failed; other evaluation errors
+// wrap ErrInvalidCheck.
+func (s RuleSet) Apply(resource *IngressInfo, input map[string]interface{}) (bool, error) {
+	monitored := true
+	for _, rule := range s {
+		if rule.when != nil {
+			value, ok, err := evalRule(rule.when, input)
+			if err != nil {
+				return false, fmt.Errorf("%w: rule %s: when: %w", ErrInvalidCheck, rule.name, err)
+			}
+			if !ok {
+				continue
+			}
+			matches, isBool := value.(bool)
+			if !isBool {
+				return false, fmt.Errorf("%w: rule %s: when must be a bool, got %T", ErrInvalidCheck, rule.name, value)
+			}
+			if !matches {
+				continue
+			}
+		}
+		if rule.monitor != nil {
+			value, ok, err := evalRule(rule.monitor, input)
+			if err != nil {
+				return false, fmt.Errorf("%w: rule %s: monitor: %w", ErrInvalidCheck, rule.name, err)
+			}
+			if ok {
+				monitor, isBool := value.(bool)
+				if !isBool {
+					return false, fmt.Errorf("%w: rule %s: monitor must be a bool, got %T", ErrInvalidCheck, rule.name, value)
+				}
+				monitored = monitor
+			}
+		}
+		for field, program := range rule.set {
+			value, ok, err := evalRule(program, input)
+			if err != nil {
+				return false, fmt.Errorf("%w: rule %s: set %s: %w", ErrInvalidCheck, rule.name, field, err)
+			}
+			if ok {
+				*ruleFields[field](resource) = fmt.Sprint(value)
+			}
+		}
+	}
+	return monitored, nil
+}
+
+// evalRule evaluates a program, ok is false when it reads a missing field
+func evalRule(program cel.Program, input map[string]interface{}) (interface{}, bool, error) {
+	value, _, err := program.Eval(input)
+	if err != nil {
+		if celMissingKey(err) {
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+	return value.Value(), true, nil
+}
@@ -0,0 +1,78 @@
+package utils
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("Rules", func() {
+	newIngress := func(annotations map[string]string) *networkingv1.Ingress {
+		return &networkingv1.Ingress{
+			ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "shop", Annotations: annotations,
+				Labels: map[string]string{"team": "checkout"}},
+			Spec: networkingv1.IngressSpec{Rules: []networkingv1.IngressRule{{Host: "shop.example.com"}}},
+		}
+	}
+	namespace := func(labels map[string]string) *corev1.Namespace {
+		return &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "shop", Labels: labels}}
+	}
+
+	rules, err := CompileRules([]Rule{
+		{Name: "tiers", Set: map[string]string{
+			"interval": "ns.labels.tier == 'prod' ? 30 : 300",
+			"path":     "'/healthz'",
+		}},
+		{Name: "sandbox", When: "ns.labels.tier == 'sandbox'", Monitor: "false"},
+		{Name: "teams", When: "ingress.metadata.labels.team == 'checkout'", Set: map[string]string{"method": "'HEAD'"}},
+	})
+
+	It("should compute settings before the annotations", func() {
+		Expect(err).NotTo(HaveOccurred())
+
+		info, err := IngressInfoWithRules(newIngress(nil), namespace(map[string]string{"tier": "prod"}), rules)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(info.Interval).To(Equal("30"))
+		Expect(info.Path).To(Equal("/healthz"))
+		Expect(info.Method).To(Equal("HEAD"))
+
+		info, err = IngressInfoWithRules(newIngress(map[string]string{HealthCheckInterval: "10s"}),
+			namespace(map[string]string{"tier": "dev"}), rules)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(info.Interval).To(Equal("10s"))
+	})
+
+	It("should skip the expressions reading missing fields", func() {
+		info, err := IngressInfoWithRules(newIngress(nil), namespace(nil), rules)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(info.Interval).To(Equal(NewIngressInfo().Interval))
+		Expect(info.Path).To(Equal("/healthz"))
+	})
+
+	It("should opt ingresses out of monitoring", func() {
+		_, err := IngressInfoWithRules(newIngress(nil), namespace(map[string]string{"tier": "sandbox"}), rules)
+		Expect(err).To(MatchError(ErrNotMonitored))
+	})
+
+	It("should reject invalid rules", func() {
+		_, err := CompileRules([]Rule{{Set: map[string]string{"owner": "'me'"}}})
+		Expect(err).To(MatchError(ContainSubstring("unknown setting")))
+		_, err = CompileRules([]Rule{{When: "ns.labels.tier =="}})
+		Expect(err).To(HaveOccurred())
+
+		bad, err := CompileRules([]Rule{{When: "'yes'"}})
+		Expect(err).NotTo(HaveOccurred())
+		_, err = IngressInfoWithRules(newIngress(nil), nil, bad)
+		Expect(err).To(MatchError(ContainSubstring("must be a bool")))
+		Expect(err).To(MatchError(ErrInvalidCheck))
+
+		failing, err := CompileRules([]Rule{{Name: "division", Set: map[string]string{"interval": "1 / 0"}}})
+		Expect(err).NotTo(HaveOccurred())
+		_, err = IngressInfoWithRules(newIngress(nil), nil, failing)
+		Expect(err).To(MatchError(ErrInvalidCheck))
+		Expect(err).To(MatchError(ContainSubstring("division")))
+	})
+})
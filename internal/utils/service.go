@@ -0,0 +1,116 @@
+package utils
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Monitor opts a resource other than an Ingress, such as a Service, in to monitoring
+var Monitor string = "wenti.dev/monitor"
+
+// ExternalDNSHostname is the annotation external-dns publishes the records of a Service from
+var ExternalDNSHostname string = "external-dns.alpha.kubernetes.io/hostname"
+
+// MonitorEnabled reports whether the resource opted in to monitoring
+func MonitorEnabled(annotations map[string]string) bool {
+	return annotations[Monitor] == "true"
+}
+
+// ServiceTarget returns the host a LoadBalancer Service is reached at: the first external-dns
+// hostname, else the hostname or IP of the load balancer
+func ServiceTarget(service *corev1.Service) string {
+	if hostnames := service.Annotations[ExternalDNSHostname]; hostnames != "" {
+		return strings.TrimSpace(strings.Split(hostnames, ",")[0])
+	}
+	for _, ingress := range service.Status.LoadBalancer.Ingress {
+		if ingress.Hostname != "" {
+			return ingress.Hostname
+		}
+		if ingress.IP != "" {
+			return ingress.IP
+		}
+	}
+	return ""
+}
+
+// portProtocol chooses the protocol probing a port from its appProtocol, or from its number
+// when unset. It returns false for ports which cannot be probed over HTTP or gRPC.
+func portProtocol(port corev1.ServicePort) (string, bool) {
+	if port.Protocol != "" && port.Protocol != corev1.ProtocolTCP {
+		return "", false
+	}
+	if port.AppProtocol == nil {
+		if port.Port == 443 || port.Port == 8443 {
+			return "https", true
+		}
+		return "http", true
+	}
+	switch strings.ToLower(*port.AppProtocol) {
+	case "http", "kubernetes.io/h2c", "kubernetes.io/ws":
+		return "http", true
+	case "https", "kubernetes.io/wss":
+		return "https", true
+	case "grpc":
+		if port.Port == 443 || port.Port == 8443 {
+			return ProtocolGRPCS, true
+		}
+		return ProtocolGRPC, true
+	}
+	return "", false
+}
+
+// ServiceChecks builds one check per port of a LoadBalancer Service from the defaults and the
+// wenti.dev/health-check-* annotations. The port annotation restricts the checks to that port.
+func ServiceChecks(service *corev1.Service) ([]IngressInfo, error) {
+	target := ServiceTarget(service)
+	if target == "" {
+		return nil, ErrNoHost
+	}
+
+	var checks []IngressInfo
+	for _, port := range service.Spec.Ports {
+		number := strconv.Itoa(int(port.Port))
+		if only := service.Annotations[HealthCheckPort]; only != "" && only != number && only != port.Name {
+			continue
+		}
+		protocol, ok := portProtocol(port)
+		if !ok {
+			continue
+		}
+
+		check := NewIngressInfo()
+		check.Name = fmt.Sprintf("%s_%s_%s", service.Namespace, service.Name, number)
+		check.Description = check.Name
+		check.Owner = OwnerKey("Service", service.Namespace, service.Name)
+		check.Key = number
+		check.Target = target
+		check.Port = number
+		check.Protocol = protocol
+		ApplyAnnotations(&check, portAnnotations(service.Annotations, protocol))
+		if err := applyNames(&check, service); err != nil {
+			return nil, err
+		}
+		checks = append(checks, check)
+	}
+	return checks, nil
+}
+
+// portAnnotations returns the annotations of a Service which apply to a port on the protocol,
+// so that the HTTP settings of a Service do not spill over to its gRPC ports and conversely
+func portAnnotations(annotations map[string]string, protocol string) map[string]string {
+	skip := []string{HealthCheckGRPCService}
+	if !IsHTTPProtocol(protocol) {
+		skip = []string{HealthCheckPath, HealthCheckMethod, HealthCheckHTTPCode}
+	}
+	result := make(map[string]string, len(annotations))
+	for key, value := range annotations {
+		result[key] = value
+	}
+	for _, key := range skip {
+		delete(result, key)
+	}
+	return result
+}
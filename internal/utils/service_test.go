@@ -0,0 +1,103 @@
+package utils
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("Service checks", func() {
+	newService := func(annotations map[string]string, ports ...corev1.ServicePort) *corev1.Service {
+		return &corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default", Annotations: annotations},
+			Spec:       corev1.ServiceSpec{Type: corev1.ServiceTypeLoadBalancer, Ports: ports},
+			Status: corev1.ServiceStatus{LoadBalancer: corev1.LoadBalancerStatus{
+				Ingress: []corev1.LoadBalancerIngress{{IP: "203.0.113.10"}},
+			}},
+		}
+	}
+	appProtocol := func(protocol string) *string { return &protocol }
+
+	It("should build one check per probable port", func() {
+		service := newService(map[string]string{HealthCheckPath: "/healthz"},
+			corev1.ServicePort{Name: "http", Port: 80},
+			corev1.ServicePort{Name: "https", Port: 8443, AppProtocol: appProtocol("https")},
+			corev1.ServicePort{Name: "dns", Port: 53, Protocol: corev1.ProtocolUDP},
+			corev1.ServicePort{Name: "db", Port: 5432, AppProtocol: appProtocol("postgresql")},
+		)
+
+		checks, err := ServiceChecks(service)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(checks).To(HaveLen(2))
+		Expect(checks[0].Target).To(Equal("203.0.113.10"))
+		Expect(checks[0].Protocol).To(Equal("http"))
+		Expect(checks[0].Path).To(Equal("/healthz"))
+		Expect(checks[0].Key).To(Equal("80"))
+		Expect(checks[1].Protocol).To(Equal("https"))
+		Expect(checks[1].Owner).To(Equal(OwnerKey("Service", "default", "web")))
+		Expect(checks[1].Name).To(Equal("default_web_8443"))
+	})
+
+	It("should probe grpc ports with the gRPC health service", func() {
+		service := newService(map[string]string{HealthCheckPath: "/healthz", HealthCheckGRPCService: "shop.Cart"},
+			corev1.ServicePort{Name: "http", Port: 80},
+			corev1.ServicePort{Name: "grpc", Port: 443, AppProtocol: appProtocol("grpc")},
+		)
+
+		checks, err := ServiceChecks(service)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(checks).To(HaveLen(2))
+		Expect(checks[0].Path).To(Equal("/healthz"))
+		Expect(checks[0].GRPCService).To(BeEmpty())
+		Expect(checks[1].Protocol).To(Equal(ProtocolGRPCS))
+		Expect(checks[1].Path).To(BeEmpty())
+		Expect(checks[1].Method).To(BeEmpty())
+		Expect(checks[1].GRPCService).To(Equal("shop.Cart"))
+		for _, check := range checks {
+			Expect(ValidateIngressInfo(check)).To(BeEmpty())
+		}
+	})
+
+	It("should prefer the external-dns hostname and honor the port annotation", func() {
+		service := newService(map[string]string{
+			ExternalDNSHostname: "web.example.com, www.example.com",
+			HealthCheckPort:     "https",
+		},
+			corev1.ServicePort{Name: "http", Port: 80},
+			corev1.ServicePort{Name: "https", Port: 443},
+		)
+
+		checks, err := ServiceChecks(service)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(checks).To(HaveLen(1))
+		Expect(checks[0].Target).To(Equal("web.example.com"))
+		Expect(checks[0].Port).To(Equal("443"))
+		Expect(checks[0].Protocol).To(Equal("https"))
+	})
+
+	It("should wait for the load balancer address", func() {
+		service := newService(nil, corev1.ServicePort{Port: 80})
+		service.Status.LoadBalancer.Ingress = nil
+		_, err := ServiceChecks(service)
+		Expect(err).To(MatchError(ErrNoHost))
+	})
+
+	It("should find each check of an owner by key", func() {
+		cache := NewCheckCache()
+		owner := OwnerKey("Service", "default", "web")
+		for _, key := range []string{"80", "443"} {
+			cache.Put(RemoteCheck{ID: key, Labels: map[string]string{
+				ManagedByLabel: ManagedByValue, ClusterLabel: ClusterName, OwnerLabel: owner, CheckKeyLabel: key,
+			}})
+		}
+
+		check, ok, err := cache.Find(IngressInfo{Owner: owner, Key: "443"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ok).To(BeTrue())
+		Expect(check.ID).To(Equal("443"))
+		_, ok, _ = cache.Find(IngressInfo{Owner: owner})
+		Expect(ok).To(BeFalse())
+	})
+})
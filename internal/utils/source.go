@@ -0,0 +1,78 @@
+package utils
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// hostPath is a host and path found in the routing rules of an object
+type hostPath struct {
+	host string
+	path string
+	// protocol and port override the ones derived from TLS when set
+	protocol string
+	port     string
+}
+
+// hostPathChecks builds one check per distinct host and path of the object, from the
+// defaults and its wenti.dev/health-check-* annotations. The checks are told apart by
+// host and path, so that a path annotation collapses the paths of a host into one check.
+func hostPathChecks(obj *unstructured.Unstructured, targets []hostPath, tls bool) ([]IngressInfo, error) {
+	annotations := obj.GetAnnotations()
+	name := fmt.Sprintf("%s_%s", obj.GetNamespace(), obj.GetName())
+	seen := map[string]bool{}
+	var checks []IngressInfo
+	for _, target := range targets {
+		if target.host == "" {
+			continue
+		}
+		check := NewIngressInfo()
+		check.Name = name
+		check.Owner = OwnerKey(obj.GetKind(), obj.GetNamespace(), obj.GetName())
+		check.Target = target.host
+		check.Port = "80"
+		check.Protocol = "http"
+		if tls {
+			check.Port = "443"
+			check.Protocol = "https"
+		}
+		if target.protocol != "" {
+			check.Protocol = target.protocol
+			check.Port = target.port
+		}
+		if target.path != "" {
+			check.Path = target.path
+		}
+		if value := annotations[HealthCheckPort]; value != "" {
+			check.Port = value
+		}
+		ApplyAnnotations(&check, annotations)
+
+		check.Key = check.Target + check.Path
+		if seen[check.Key] {
+			continue
+		}
+		seen[check.Key] = true
+		check.Description = fmt.Sprintf("%s %s%s", name, check.Target, check.Path)
+		if err := applyNames(&check, obj); err != nil {
+			return nil, err
+		}
+		checks = append(checks, check)
+	}
+	if len(checks) == 0 {
+		return nil, ErrNoHost
+	}
+	sort.Slice(checks, func(i, j int) bool { return checks[i].Key < checks[j].Key })
+	return checks, nil
+}
+
+// pathPrefix returns the path a check probes for a route prefix, which may be empty
+func pathPrefix(prefix string) string {
+	if prefix == "" || strings.HasPrefix(prefix, "/") {
+		return prefix
+	}
+	return "/" + prefix
+}
@@ -0,0 +1,80 @@
+package utils
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func newSource(gvk schema.GroupVersionKind, spec map[string]interface{}) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{Object: map[string]interface{}{"spec": spec}}
+	obj.SetGroupVersionKind(gvk)
+	obj.SetNamespace("shop")
+	obj.SetName("web")
+	return obj
+}
+
+var _ = Describe("Traefik checks", func() {
+	It("should parse host and path matchers", func() {
+		Expect(parseTraefikRule("Host(`example.com`) && PathPrefix(`/api`)")).To(Equal(hostPath{host: "example.com", path: "/api"}))
+		Expect(parseTraefikRule(`Path("/healthz") && Host("a.example.com", "b.example.com")`)).
+			To(Equal(hostPath{host: "a.example.com", path: "/healthz"}))
+		Expect(parseTraefikRule("HostRegexp(`{sub:[a-z]+}.example.com`)")).To(Equal(hostPath{}))
+	})
+
+	It("should build one check per host and path", func() {
+		route := newSource(TraefikIngressRouteGVK, map[string]interface{}{
+			"routes": []interface{}{
+				map[string]interface{}{"match": "Host(`example.com`) && PathPrefix(`/api`)"},
+				map[string]interface{}{"match": "Host(`example.com`)"},
+				map[string]interface{}{"match": "Host(`example.com`) && PathPrefix(`/api`) && Method(`POST`)"},
+			},
+			"tls": map[string]interface{}{"certResolver": "default"},
+		})
+
+		checks, err := TraefikChecks(route)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(checks).To(HaveLen(2))
+		Expect(checks[0].Key).To(Equal("example.com/"))
+		Expect(checks[1].Path).To(Equal("/api"))
+		Expect(checks[1].Protocol).To(Equal("https"))
+		Expect(checks[1].Owner).To(Equal("IngressRoute/shop/web"))
+
+		route.SetGroupVersionKind(LegacyTraefikIngressRouteGVK)
+		checks, err = TraefikChecks(route)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(checks[0].Owner).To(Equal("IngressRoute.traefik.containo.us/shop/web"))
+
+		route.SetAnnotations(map[string]string{HealthCheckPath: "/healthz"})
+		checks, err = TraefikChecks(route)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(checks).To(HaveLen(1))
+		Expect(checks[0].Path).To(Equal("/healthz"))
+	})
+})
+
+var _ = Describe("Contour checks", func() {
+	It("should build one check per route prefix of the virtual host", func() {
+		proxy := newSource(HTTPProxyGVK, map[string]interface{}{
+			"virtualhost": map[string]interface{}{"fqdn": "shop.example.com"},
+			"routes": []interface{}{
+				map[string]interface{}{"conditions": []interface{}{map[string]interface{}{"prefix": "/cart"}}},
+				map[string]interface{}{"conditions": []interface{}{map[string]interface{}{"header": map[string]interface{}{"name": "x"}}}},
+			},
+		})
+
+		checks, err := HTTPProxyChecks(proxy)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(checks).To(HaveLen(1))
+		Expect(checks[0].Target).To(Equal("shop.example.com"))
+		Expect(checks[0].Path).To(Equal("/cart"))
+		Expect(checks[0].Protocol).To(Equal("http"))
+	})
+
+	It("should skip included proxies", func() {
+		_, err := HTTPProxyChecks(newSource(HTTPProxyGVK, map[string]interface{}{}))
+		Expect(err).To(MatchError(ErrNoHost))
+	})
+})
@@ -0,0 +1,95 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	clientsdk "github.com/wentidev/sdk-go"
+)
+
+// SpecHashLabel records on the remote check the hash of the spec last applied by the agent
+const SpecHashLabel = "wenti.dev/spec-hash"
+
+// DesiredSpec converts the resource to the body sent to the server, labelled with the
+// hash of its content, and returns that hash
+func DesiredSpec(resource IngressInfo) (clientsdk.PutApiV1HealthchecksIdJSONRequestBody, string, error) {
+	if errs := ValidateIngressInfo(resource); len(errs) > 0 {
+		return clientsdk.PutApiV1HealthchecksIdJSONRequestBody{}, "", errors.Join(errs...)
+	}
+	interval, err := ConvertDurationToSeconds(resource.Interval)
+	if err != nil {
+		return clientsdk.PutApiV1HealthchecksIdJSONRequestBody{}, "", fmt.Errorf("invalid interval: %w", err)
+	}
+	timeout, err := ConvertDurationToSeconds(resource.Timeout)
+	if err != nil {
+		return clientsdk.PutApiV1HealthchecksIdJSONRequestBody{}, "", fmt.Errorf("invalid timeout: %w", err)
+	}
+	port, err := ConvertStringToInt(resource.Port)
+	if err != nil {
+		return clientsdk.PutApiV1HealthchecksIdJSONRequestBody{}, "", fmt.Errorf("invalid port: %w", err)
+	}
+
+	spec := clientsdk.PutApiV1HealthchecksIdJSONRequestBody{
+		Description: resource.Description,
+		Enabled:     resource.Enabled,
+		HttpCode:    resource.HTTPCode,
+		Interval:    interval,
+		Labels:      ownerLabels(resource),
+		Method:      resource.Method,
+		Name:        resource.Name,
+		Path:        resource.Path,
+		Port:        port,
+		Protocol:    resource.Protocol,
+		Target:      resource.Target,
+		Timeout:     timeout,
+	}
+	if len(resource.Headers) > 0 {
+		headers := make(map[string]interface{}, len(resource.Headers))
+		for key, value := range resource.Headers {
+			headers[key] = value
+		}
+		spec.Headers = &headers
+	}
+	if IsGRPCProtocol(resource.Protocol) && resource.GRPCService != "" {
+		// The gRPC health request, grpc.health.v1.HealthCheckRequest in its JSON form
+		body, err := json.Marshal(map[string]string{"service": resource.GRPCService})
+		if err != nil {
+			return clientsdk.PutApiV1HealthchecksIdJSONRequestBody{}, "", err
+		}
+		request := string(body)
+		spec.Body = &request
+	}
+
+	// Maps are marshalled with sorted keys, which keeps the hash stable
+	data, err := json.Marshal(spec)
+	if err != nil {
+		return clientsdk.PutApiV1HealthchecksIdJSONRequestBody{}, "", err
+	}
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])[:16]
+	(*spec.Labels)[SpecHashLabel] = hash
+
+	return spec, hash, nil
+}
+
+// lastWrites records when the agent last wrote each check
+var lastWrites sync.Map
+
+// upToDate reports whether the check was last written with the given hash and
+// no forced resync is due
+func upToDate(id, hash string) bool {
+	check, ok := Checks.Get(id)
+	if !ok || check.Labels[SpecHashLabel] != hash {
+		return false
+	}
+	if ForceResyncInterval <= 0 {
+		return true
+	}
+	last, loaded := lastWrites.LoadOrStore(id, time.Now())
+	return !loaded || time.Since(last.(time.Time)) < ForceResyncInterval
+}
@@ -0,0 +1,55 @@
+package utils
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Desired spec", func() {
+	It("should accept durations for interval and timeout", func() {
+		spec, _, err := DesiredSpec(NewIngressInfo())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(spec.Interval).To(Equal(60))
+		Expect(spec.Timeout).To(Equal(30))
+		Expect(spec.Port).To(Equal(8080))
+	})
+
+	It("should compute a stable hash that follows the content", func() {
+		resource := NewIngressInfo()
+		_, first, err := DesiredSpec(resource)
+		Expect(err).NotTo(HaveOccurred())
+		spec, second, err := DesiredSpec(resource)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(second).To(Equal(first))
+		Expect((*spec.Labels)[SpecHashLabel]).To(Equal(first))
+
+		resource.Path = "/healthz"
+		_, changed, err := DesiredSpec(resource)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(changed).NotTo(Equal(first))
+	})
+
+	It("should reject invalid values", func() {
+		resource := NewIngressInfo()
+		resource.Port = "https"
+		_, _, err := DesiredSpec(resource)
+		Expect(err).To(HaveOccurred())
+
+		resource = NewIngressInfo()
+		resource.Method = "FETCH"
+		_, _, err = DesiredSpec(resource)
+		Expect(err).To(MatchError(ErrInvalidCheck))
+		Expect(err).To(MatchError(ContainSubstring("unsupported method")))
+	})
+
+	It("should reject durations shorter than a second", func() {
+		resource := NewIngressInfo()
+		resource.Timeout = "500ms"
+		_, _, err := DesiredSpec(resource)
+		Expect(err).To(MatchError(ContainSubstring("shorter than a second")))
+
+		seconds, err := ConvertDurationToSeconds("0s")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(seconds).To(BeZero())
+	})
+})
@@ -2,6 +2,12 @@ package utils
 
 type IngressInfo struct {
 	Name string `json:"name"`
+	// Owner identifies the resource the check is derived from, see OwnerKey
+	Owner string `json:"owner"`
+	// ID is the check recorded on the resource, if any
+	ID string `json:"id,omitempty"`
+	// Key distinguishes the checks of a resource deriving several of them, such as one per port
+	Key string `json:"key,omitempty"`
 
 	// optional
 	Description string `json:"description"`
@@ -13,7 +19,13 @@ type IngressInfo struct {
 	Timeout     string `json:"timeout"`
 	Interval    string `json:"interval"`
 	HTTPCode    string `json:"httpCode"`
-	Enabled     bool   `json:"enabled"`
+	// GRPCService is the service a grpc check asks the health of
+	GRPCService string `json:"grpcService,omitempty"`
+	// Headers are sent with the requests of HTTP checks
+	Headers map[string]string `json:"headers,omitempty"`
+	Enabled bool              `json:"enabled"`
+	// Violations are the policy rules the check breaks, its settings already clamped
+	Violations []PolicyViolation `json:"-"`
 }
 
 func NewIngressInfo() IngressInfo {
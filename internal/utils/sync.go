@@ -0,0 +1,43 @@
+package utils
+
+import (
+	"context"
+	"errors"
+
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// SyncHealthChecks creates or updates the checks derived from a resource, told apart by
+// their Key, and deletes the checks of the owner it no longer derives. A nil desired list
+// deletes every check of the owner.
+func SyncHealthChecks(ctx context.Context, owner string, desired []IngressInfo) ([]string, error) {
+	var statuses []string
+	var errs []error
+	keys := map[string]bool{}
+	for _, resource := range desired {
+		keys[resource.Key] = true
+		status, err := CreateOrUpdateHealthCheck(ctx, resource)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		statuses = append(statuses, status)
+	}
+
+	if err := Checks.EnsureSynced(ctx); err != nil {
+		return statuses, errors.Join(append(errs, err)...)
+	}
+	for _, check := range Checks.ByOwner(owner) {
+		if keys[check.Labels[CheckKeyLabel]] {
+			continue
+		}
+		log.Log.Info("health check no longer derived from its owner", "owner", owner, "id", check.ID)
+		status, err := DeleteHealthCheckByID(ctx, check)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, errors.Join(errs...)
+}
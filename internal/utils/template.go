@@ -0,0 +1,55 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	monitoringv1alpha1 "github.com/wentidev/agent/api/v1alpha1"
+)
+
+// HealthCheckTemplate names the HealthCheckTemplate, or else ClusterHealthCheckTemplate, an
+// Ingress takes its settings from
+var HealthCheckTemplate string = "wenti.dev/health-check-template"
+
+// ErrTemplateNotFound is returned for Ingresses referencing a template which does not exist
+var ErrTemplateNotFound = errors.New("health check template not found")
+
+// ApplyTemplate sets the settings of the template on the resource, keeping the others
+func ApplyTemplate(resource *IngressInfo, spec monitoringv1alpha1.HealthCheckTemplateSpec) {
+	for _, field := range []struct {
+		value   string
+		setting *string
+	}{
+		{spec.Protocol, &resource.Protocol},
+		{spec.Path, &resource.Path},
+		{spec.Method, &resource.Method},
+		{spec.SuccessCodes, &resource.HTTPCode},
+		{spec.GRPCService, &resource.GRPCService},
+	} {
+		if field.value != "" {
+			*field.setting = field.value
+		}
+	}
+	if spec.Port != nil {
+		resource.Port = fmt.Sprint(*spec.Port)
+	}
+	if spec.Timeout != nil {
+		resource.Timeout = wholeSeconds(spec.Timeout.Duration)
+	}
+	if spec.Interval != nil {
+		resource.Interval = wholeSeconds(spec.Interval.Duration)
+	}
+	if len(spec.Headers) > 0 {
+		resource.Headers = make(map[string]string, len(spec.Headers))
+		for key, value := range spec.Headers {
+			resource.Headers[key] = value
+		}
+	}
+}
+
+// wholeSeconds formats the duration in seconds, the unit of the API, rounding the fractions
+// up so that sub-second durations are not truncated to zero
+func wholeSeconds(duration time.Duration) string {
+	return fmt.Sprintf("%ds", (duration+time.Second-1)/time.Second)
+}
@@ -0,0 +1,64 @@
+package utils
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	monitoringv1alpha1 "github.com/wentidev/agent/api/v1alpha1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("Health check templates", func() {
+	port := int32(8080)
+	template := &monitoringv1alpha1.HealthCheckTemplateSpec{
+		Path:     "/healthz",
+		Port:     &port,
+		Headers:  map[string]string{"Accept": "application/json"},
+		Timeout:  &metav1.Duration{Duration: 2 * time.Second},
+		Interval: &metav1.Duration{Duration: 10 * time.Second},
+	}
+	newIngress := func(annotations map[string]string) *networkingv1.Ingress {
+		return &networkingv1.Ingress{
+			ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "shop", Annotations: annotations},
+			Spec:       networkingv1.IngressSpec{Rules: []networkingv1.IngressRule{{Host: "shop.example.com"}}},
+		}
+	}
+
+	It("should apply the template before the annotations", func() {
+		info, err := IngressInfoWithSettings(newIngress(map[string]string{HealthCheckInterval: "30s"}),
+			IngressSettings{Template: template})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(info.Path).To(Equal("/healthz"))
+		Expect(info.Port).To(Equal("8080"))
+		Expect(info.Timeout).To(Equal("2s"))
+		Expect(info.Interval).To(Equal("30s"))
+		Expect(info.Method).To(Equal("GET"))
+
+		spec, _, err := DesiredSpec(info)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(spec.Headers).To(HaveValue(HaveKeyWithValue("Accept", "application/json")))
+	})
+
+	It("should keep the defaults without a template", func() {
+		info, err := IngressInfoWithSettings(newIngress(nil), IngressSettings{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(info.Headers).To(BeEmpty())
+		spec, _, err := DesiredSpec(info)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(spec.Headers).To(BeNil())
+	})
+
+	It("should round the durations up to whole seconds", func() {
+		info, err := IngressInfoWithSettings(newIngress(nil), IngressSettings{Template: &monitoringv1alpha1.HealthCheckTemplateSpec{
+			Timeout:  &metav1.Duration{Duration: 500 * time.Millisecond},
+			Interval: &metav1.Duration{Duration: 10*time.Second + time.Millisecond},
+		}})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(info.Timeout).To(Equal("1s"))
+		Expect(info.Interval).To(Equal("11s"))
+		Expect(DesiredSpec(info)).Error().NotTo(HaveOccurred())
+	})
+})
@@ -0,0 +1,70 @@
+package utils
+
+import (
+	"regexp"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// Traefik IngressRoute kinds, under the current and the legacy API group
+var (
+	TraefikIngressRouteGVK       = schema.GroupVersionKind{Group: "traefik.io", Version: "v1alpha1", Kind: "IngressRoute"}
+	LegacyTraefikIngressRouteGVK = schema.GroupVersionKind{Group: "traefik.containo.us", Version: "v1alpha1", Kind: "IngressRoute"}
+)
+
+// LegacyTraefikOwnerKind is the kind recorded in the owner of the checks of legacy
+// IngressRoutes, so that they are told apart from the ones of the current group
+var LegacyTraefikOwnerKind = LegacyTraefikIngressRouteGVK.Kind + "." + LegacyTraefikIngressRouteGVK.Group
+
+// traefikMatcher captures the arguments of a Traefik rule matcher such as Host(`example.com`)
+var traefikMatcher = regexp.MustCompile("\\b(Host|PathPrefix|Path)\\(([^)]*)\\)")
+
+// traefikArgument captures the values quoted with backticks or double quotes
+var traefikArgument = regexp.MustCompile("[`\"]([^`\"]*)[`\"]")
+
+// parseTraefikRule returns the first host and path of a Traefik match rule. HostRegexp and
+// PathRegexp matchers are ignored as they name no concrete host or path.
+func parseTraefikRule(rule string) hostPath {
+	target := hostPath{}
+	for _, matcher := range traefikMatcher.FindAllStringSubmatch(rule, -1) {
+		arguments := traefikArgument.FindAllStringSubmatch(matcher[2], -1)
+		if len(arguments) == 0 {
+			continue
+		}
+		value := strings.TrimSpace(arguments[0][1])
+		switch matcher[1] {
+		case "Host":
+			if target.host == "" {
+				target.host = value
+			}
+		case "PathPrefix", "Path":
+			if target.path == "" {
+				target.path = pathPrefix(value)
+			}
+		}
+	}
+	return target
+}
+
+// TraefikChecks builds one check per host and path matched by the routes of a Traefik
+// IngressRoute, over HTTPS when it terminates TLS
+func TraefikChecks(route *unstructured.Unstructured) ([]IngressInfo, error) {
+	routes, _, _ := unstructured.NestedSlice(route.Object, "spec", "routes")
+	var targets []hostPath
+	for _, item := range routes {
+		if spec, ok := item.(map[string]interface{}); ok {
+			match, _, _ := unstructured.NestedString(spec, "match")
+			targets = append(targets, parseTraefikRule(match))
+		}
+	}
+	_, tls, _ := unstructured.NestedFieldNoCopy(route.Object, "spec", "tls")
+	checks, err := hostPathChecks(route, targets, tls)
+	if route.GroupVersionKind().Group == LegacyTraefikIngressRouteGVK.Group {
+		for i := range checks {
+			checks[i].Owner = OwnerKey(LegacyTraefikOwnerKind, route.GetNamespace(), route.GetName())
+		}
+	}
+	return checks, err
+}
@@ -1,7 +1,9 @@
 package utils
 
 import (
+	"fmt"
 	"strconv"
+	"time"
 )
 
 func ConvertStringToInt(s string) (int, error) {
@@ -11,3 +13,18 @@ func ConvertStringToInt(s string) (int, error) {
 	}
 	return result, nil
 }
+
+// ConvertDurationToSeconds accepts a number of seconds or a duration such as "30s"
+func ConvertDurationToSeconds(s string) (int, error) {
+	if result, err := strconv.Atoi(s); err == nil {
+		return result, nil
+	}
+	duration, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, err
+	}
+	if duration > 0 && duration < time.Second {
+		return 0, fmt.Errorf("duration %s is shorter than a second", s)
+	}
+	return int(duration.Seconds()), nil
+}
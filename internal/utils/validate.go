@@ -0,0 +1,85 @@
+package utils
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// KnownAnnotations returns the wenti.dev/ annotations the agent reads or writes on resources
+func KnownAnnotations() []string {
+	return []string{
+		HealthCheckPath,
+		HealthCheckProtocol,
+		HealthCheckMethod,
+		HealthCheckHTTPCode,
+		HealthCheckTimeout,
+		HealthCheckInterval,
+		HealthCheckPort,
+		ScaledDown,
+		HealthCheckStatus,
+		HealthCheckID,
+		MaintenanceUntil,
+		MaintenanceWindow,
+		Monitor,
+		HealthCheckGRPCService,
+		HealthCheckTemplate,
+	}
+}
+
+var methods = []string{
+	http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut,
+	http.MethodPatch, http.MethodDelete, http.MethodOptions,
+}
+
+// ValidateIngressInfo returns the problems of the resource which the server or the probes
+// would trip on, as ErrInvalidCheck errors
+func ValidateIngressInfo(resource IngressInfo) []error {
+	errs := ValidateProtocol(resource)
+	if IsHTTPProtocol(strings.ToLower(resource.Protocol)) {
+		errs = append(errs, validateHTTP(resource)...)
+	}
+	if port, err := ConvertStringToInt(resource.Port); err != nil {
+		errs = append(errs, fmt.Errorf("%w: %s: invalid port %q", ErrInvalidCheck, HealthCheckPort, resource.Port))
+	} else if port < 1 || port > 65535 {
+		errs = append(errs, fmt.Errorf("%w: %s: port %d out of range", ErrInvalidCheck, HealthCheckPort, port))
+	}
+
+	if interval, err := ConvertDurationToSeconds(resource.Interval); err != nil {
+		errs = append(errs, fmt.Errorf("%w: %s: invalid interval: %v", ErrInvalidCheck, HealthCheckInterval, err))
+	} else if interval <= 0 {
+		errs = append(errs, fmt.Errorf("%w: %s: interval must be positive", ErrInvalidCheck, HealthCheckInterval))
+	}
+	if timeout, err := ConvertDurationToSeconds(resource.Timeout); err != nil {
+		errs = append(errs, fmt.Errorf("%w: %s: invalid timeout: %v", ErrInvalidCheck, HealthCheckTimeout, err))
+	} else if timeout <= 0 {
+		errs = append(errs, fmt.Errorf("%w: %s: timeout must be positive", ErrInvalidCheck, HealthCheckTimeout))
+	}
+	return errs
+}
+
+// validateHTTP returns the problems of the request settings of an HTTP check
+func validateHTTP(resource IngressInfo) []error {
+	var errs []error
+	if !containsFold(methods, resource.Method) {
+		errs = append(errs, fmt.Errorf("%w: %s: unsupported method %q", ErrInvalidCheck, HealthCheckMethod, resource.Method))
+	}
+	if !strings.HasPrefix(resource.Path, "/") {
+		errs = append(errs, fmt.Errorf("%w: %s: path %q must start with /", ErrInvalidCheck, HealthCheckPath, resource.Path))
+	}
+	for _, code := range strings.Split(resource.HTTPCode, ",") {
+		if value, err := ConvertStringToInt(strings.TrimSpace(code)); err != nil || value < 100 || value > 599 {
+			errs = append(errs, fmt.Errorf("%w: %s: invalid status code %q", ErrInvalidCheck, HealthCheckHTTPCode, code))
+		}
+	}
+	return errs
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
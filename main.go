@@ -17,10 +17,14 @@ limitations under the License.
 package main
 
 import (
+	"context"
 	"crypto/tls"
 	"flag"
 	"os"
+	"time"
 
+	"github.com/wentidev/agent/internal/cmd"
+	"github.com/wentidev/agent/internal/tracing"
 	"github.com/wentidev/agent/internal/utils"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
@@ -33,10 +37,12 @@ import (
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
 	"sigs.k8s.io/controller-runtime/pkg/metrics/filters"
 	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
 	"sigs.k8s.io/controller-runtime/pkg/webhook"
 
+	monitoringv1alpha1 "github.com/wentidev/agent/api/v1alpha1"
 	"github.com/wentidev/agent/internal/controller"
 	// +kubebuilder:scaffold:imports
 )
@@ -49,15 +55,24 @@ var (
 func init() {
 	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
 
+	utilruntime.Must(monitoringv1alpha1.AddToScheme(scheme))
 	// +kubebuilder:scaffold:scheme
 }
 
 func main() {
+	if len(os.Args) > 1 {
+		if run, ok := cmd.Commands[os.Args[1]]; ok {
+			os.Exit(run(os.Args[2:]))
+		}
+	}
+
 	var metricsAddr string
 	var enableLeaderElection bool
 	var probeAddr string
 	var secureMetrics bool
 	var enableHTTP2 bool
+	var maxConcurrentReconciles int
+	var debounce time.Duration
 	var tlsOpts []func(*tls.Config)
 	flag.StringVar(&metricsAddr, "metrics-bind-address", "0", "The address the metrics endpoint binds to. "+
 		"Use :8443 for HTTPS or :8080 for HTTP, or leave as 0 to disable the metrics service.")
@@ -69,6 +84,10 @@ func main() {
 		"If set, the metrics endpoint is served securely via HTTPS. Use --metrics-secure=false to use HTTP instead.")
 	flag.BoolVar(&enableHTTP2, "enable-http2", false,
 		"If set, HTTP/2 will be enabled for the metrics and webhook servers")
+	flag.IntVar(&maxConcurrentReconciles, "max-concurrent-reconciles", 1,
+		"The maximum number of Ingresses reconciled in parallel.")
+	flag.DurationVar(&debounce, "debounce", 2*time.Second,
+		"How long an updated Ingress must stay unchanged before it is reconciled.")
 
 	utils.InitFlags()
 
@@ -80,6 +99,22 @@ func main() {
 
 	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
 
+	if err := utils.ValidateRateLimit(); err != nil {
+		setupLog.Error(err, "invalid flags")
+		os.Exit(1)
+	}
+
+	shutdownTracing := func(context.Context) error { return nil }
+	if utils.OTLPEndpoint != "" {
+		var err error
+		shutdownTracing, err = tracing.Setup(context.Background(), utils.OTLPEndpoint, utils.OTLPInsecure)
+		if err != nil {
+			setupLog.Error(err, "unable to set up tracing")
+			os.Exit(1)
+		}
+		setupLog.Info("exporting traces", "endpoint", utils.OTLPEndpoint)
+	}
+
 	// if the enable-http2 flag is false (the default), http/2 should be disabled
 	// due to its vulnerabilities. More specifically, disabling http/2 will
 	// prevent from being vulnerable to the HTTP/2 Stream Cancellation and
@@ -147,15 +182,77 @@ func main() {
 		os.Exit(1)
 	}
 
+	sources := controller.OptionalSources
+	if utils.ConfigFile != "" {
+		config, err := utils.LoadConfig(utils.ConfigFile)
+		if err != nil {
+			setupLog.Error(err, "unable to load configuration")
+			os.Exit(1)
+		}
+		configured, err := controller.ConfiguredSources(config)
+		if err != nil {
+			setupLog.Error(err, "unable to load configuration")
+			os.Exit(1)
+		}
+		sources = append(sources, configured...)
+		if utils.Rules, err = utils.CompileRules(config.Rules); err != nil {
+			setupLog.Error(err, "unable to load configuration")
+			os.Exit(1)
+		}
+		if utils.Names, err = utils.CompileNames(config.Names); err != nil {
+			setupLog.Error(err, "unable to load configuration")
+			os.Exit(1)
+		}
+	}
+
 	if err = (&controller.IngressReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
+		Client:                  mgr.GetClient(),
+		Scheme:                  mgr.GetScheme(),
+		Recorder:                mgr.GetEventRecorderFor("wenti-agent"),
+		MaxConcurrentReconciles: maxConcurrentReconciles,
+		Debounce:                debounce,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "Ingress")
 		os.Exit(1)
 	}
+	if err = (&controller.ServiceReconciler{
+		Client:                  mgr.GetClient(),
+		Scheme:                  mgr.GetScheme(),
+		Recorder:                mgr.GetEventRecorderFor("wenti-agent"),
+		MaxConcurrentReconciles: maxConcurrentReconciles,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "Service")
+		os.Exit(1)
+	}
+	for _, source := range sources {
+		available, err := controller.KindAvailable(mgr.GetConfig(), source.GVK)
+		if err != nil {
+			setupLog.Error(err, "unable to discover API", "kind", source.GVK.String())
+			os.Exit(1)
+		}
+		if !available {
+			setupLog.Info("API not served by the cluster, not watching it", "kind", source.GVK.String())
+			continue
+		}
+		if err = (&controller.SourceReconciler{
+			Client:                  mgr.GetClient(),
+			Recorder:                mgr.GetEventRecorderFor("wenti-agent"),
+			Source:                  source,
+			MaxConcurrentReconciles: maxConcurrentReconciles,
+		}).SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", source.GVK.Kind)
+			os.Exit(1)
+		}
+	}
 	// +kubebuilder:scaffold:builder
 
+	if err := mgr.Add(manager.RunnableFunc(func(ctx context.Context) error {
+		return utils.Checks.Run(ctx, utils.CacheResyncInterval)
+	})); err != nil {
+		setupLog.Error(err, "unable to set up health check cache")
+		os.Exit(1)
+	}
+
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
 		setupLog.Error(err, "unable to set up health check")
 		os.Exit(1)
@@ -170,4 +267,7 @@ func main() {
 		setupLog.Error(err, "problem running manager")
 		os.Exit(1)
 	}
+	if err := shutdownTracing(context.Background()); err != nil {
+		setupLog.Error(err, "unable to flush traces")
+	}
 }